@@ -0,0 +1,168 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	xhtml "golang.org/x/net/html"
+)
+
+// articleNegativeRe and articlePositiveRe match the class and id of
+// elements that are unlikely or likely to be the main content
+var articleNegativeRe = regexp.MustCompile(`(?i)comment|footer|header|nav|menu|sidebar|aside|widget|share|social|related|promo|sponsor|advert|\bads?\b|banner|cookie|popup|modal|subscribe|newsletter`)
+var articlePositiveRe = regexp.MustCompile(`(?i)article|body|content|entry|main|post|story|text|blog`)
+
+// articleJunk are removed from the main content before extracting it
+const articleJunk = "script, style, noscript, iframe, form, nav, aside, footer, button, svg"
+
+// articleBlocks are the elements that are paragraphs of the text
+const articleBlocks = "p, h1, h2, h3, h4, h5, h6, li, blockquote, pre"
+
+// article extracts the main article of the page, like the reader mode
+// of browsers, without any selectors. It returns an object with the
+// title, byline, published time, text and html. If member is not
+// empty it returns only that member of the object.
+//
+// The main content is the only <article> of the page or else the
+// element that scores highest by the text of its paragraphs, like
+// in readability: long paragraphs with commas count more and class
+// or id names like content or sidebar count for or against.
+func article(doc *goquery.Document, member string) []interface{} {
+	content := articleContent(doc)
+	c := content.Clone()
+	c.Find(articleJunk).Remove()
+	c.Find("*").Each(func(i int, s *goquery.Selection) {
+		if cls := classAndID(s); articleNegativeRe.MatchString(cls) && !articlePositiveRe.MatchString(cls) {
+			s.Remove()
+		}
+	})
+
+	var paras []string
+	c.Find(articleBlocks).Each(func(i int, s *goquery.Selection) {
+		if s.Find(articleBlocks).Length() > 0 {
+			return
+		}
+		if t := strings.Join(strings.Fields(s.Text()), " "); t != "" {
+			paras = append(paras, t)
+		}
+	})
+	text := strings.Join(paras, "\n\n")
+	if text == "" {
+		text = strings.Join(strings.Fields(c.Text()), " ")
+	}
+	h, _ := c.Html()
+
+	a := map[string]interface{}{
+		"title":     articleTitle(doc, content),
+		"byline":    articleByline(doc),
+		"published": articlePublished(doc),
+		"text":      text,
+		"html":      strings.TrimSpace(h),
+	}
+	if member != "" {
+		return []interface{}{a[member]}
+	}
+	return []interface{}{a}
+}
+
+// articleContent returns the element with the main content
+func articleContent(doc *goquery.Document) *goquery.Selection {
+	if a := doc.Find("article"); a.Length() == 1 && len(strings.TrimSpace(a.Text())) > 140 {
+		return a
+	}
+
+	scores := make(map[*xhtml.Node]float64)
+	var order []*xhtml.Node
+	add := func(s *goquery.Selection, score float64) {
+		if s.Length() == 0 || s.Is("body, html") {
+			return
+		}
+		n := s.Get(0)
+		if _, ok := scores[n]; !ok {
+			order = append(order, n)
+			switch cls := classAndID(s); {
+			case articleNegativeRe.MatchString(cls) && !articlePositiveRe.MatchString(cls):
+				scores[n] -= 25
+			case articlePositiveRe.MatchString(cls):
+				scores[n] += 25
+			}
+		}
+		scores[n] += score
+	}
+
+	doc.Find("p, pre, td").Each(func(i int, p *goquery.Selection) {
+		t := strings.TrimSpace(p.Text())
+		if len(t) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(t, ","))
+		if l := len(t) / 100; l < 3 {
+			score += float64(l)
+		} else {
+			score += 3
+		}
+		add(p.Parent(), score)
+		add(p.Parent().Parent(), score/2)
+	})
+
+	var best *xhtml.Node
+	for _, n := range order {
+		if best == nil || scores[n] > scores[best] {
+			best = n
+		}
+	}
+	if best == nil {
+		return doc.Find("body")
+	}
+	return doc.FindNodes(best)
+}
+
+// articleTitle returns the title of the article from the open graph
+// meta tags, the heading of the content or the title of the page
+func articleTitle(doc *goquery.Document, content *goquery.Selection) string {
+	if t, ok := doc.Find(`meta[property="og:title"]`).Attr("content"); ok && strings.TrimSpace(t) != "" {
+		return strings.TrimSpace(t)
+	}
+	if h := content.Find("h1").First(); h.Length() > 0 {
+		return strings.Join(strings.Fields(h.Text()), " ")
+	}
+	if h := doc.Find("h1"); h.Length() == 1 {
+		return strings.Join(strings.Fields(h.Text()), " ")
+	}
+	return strings.TrimSpace(doc.Find("title").First().Text())
+}
+
+// articleByline returns the author of the article or nil
+func articleByline(doc *goquery.Document) interface{} {
+	if a, ok := doc.Find(`meta[name="author"]`).Attr("content"); ok && strings.TrimSpace(a) != "" {
+		return strings.TrimSpace(a)
+	}
+	s := doc.Find(`[rel="author"], [itemprop="author"], .byline, .author`).First()
+	if t := strings.Join(strings.Fields(s.Text()), " "); t != "" {
+		return t
+	}
+	return nil
+}
+
+// articlePublished returns the published time of the article or nil
+func articlePublished(doc *goquery.Document) interface{} {
+	if t, ok := doc.Find(`meta[property="article:published_time"]`).Attr("content"); ok && t != "" {
+		return strings.TrimSpace(t)
+	}
+	s := doc.Find(`[itemprop="datePublished"], time[datetime]`).First()
+	for _, attr := range []string{"content", "datetime"} {
+		if t, ok := s.Attr(attr); ok && t != "" {
+			return strings.TrimSpace(t)
+		}
+	}
+	return nil
+}
+
+// classAndID returns the class and id of s for matching against
+// articleNegativeRe and articlePositiveRe
+func classAndID(s *goquery.Selection) string {
+	c, _ := s.Attr("class")
+	id, _ := s.Attr("id")
+	return c + " " + id
+}
@@ -0,0 +1,14 @@
+package main
+
+// autoRules are the rules of humphrey auto, a standard bundle
+// for a first look at a site before writing rules for it
+var autoRules = []string{
+	"title:title",
+	"canonical:link[rel=canonical]:href",
+	"description:@meta:description",
+	"h1:h1",
+	"h2:h2",
+	"h3:h3",
+	"links:a[href]:{href,@text}",
+	"images:img[src]:{src,alt}",
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// bakeMagic ends executables with baked arguments. Before it
+// is the recipe as a json object and its length in 8 bytes.
+// Executables ignore data appended to them, so the baked
+// humphrey runs like the original one.
+const bakeMagic = "\x00humphrey-baked\x00"
+
+// recipe is what is baked in an executable, the arguments and
+// the contents of the files named by the options in bakedOptions
+type recipe struct {
+	Args  []string          `json:"args"`
+	Files map[string][]byte `json:"files,omitempty"`
+}
+
+// bakedOptions are the options whose files are baked with them
+var bakedOptions = []string{"rules", "descriptors", "pipeline", "variants", "login", "data-file"}
+
+// bakedRules are the rules baked in the executable.
+// They are applied before those of the command line.
+var bakedRules []string
+
+// bakedFiles are the files of bakedOptions baked in the executable,
+// by their names as given to the options
+var bakedFiles map[string][]byte
+
+// readOptionFile returns the content of the file named by an option,
+// baked in the executable or else read from the disk
+func readOptionFile(path string) ([]byte, error) {
+	if b, ok := bakedFiles[path]; ok {
+		return b, nil
+	}
+	return os.ReadFile(path)
+}
+
+// bake writes a copy of the running executable with args, options
+// and rules, baked in it. The copy runs as if args were given
+// before its own command line arguments, so a finished recipe
+// can be handed to others as a single tool. The file of the copy
+// is given with -o anywhere in args. The files of bakedOptions,
+// like -rules or -variants, are baked too, so the copy needs
+// nothing else to run.
+func bake(args []string) error {
+	out, baked := bakeOutput(args)
+	if out == "" {
+		return errors.New("usage: humphrey bake -o file [options] [rules]")
+	}
+	if err := flag.CommandLine.Parse(baked); err != nil {
+		return err
+	}
+	if flag.NArg() == 0 && *rulesFile == "" && *descriptors == "" && *pipelineFile == "" && len(*longRules) == 0 {
+		return errors.New("bake: no rules")
+	}
+
+	r := recipe{Args: baked, Files: make(map[string][]byte)}
+	for _, name := range bakedOptions {
+		path := flag.Lookup(name).Value.String()
+		if path == "" {
+			continue
+		}
+		if path == "-" {
+			return fmt.Errorf("bake: -%s can't be baked from stdin, give a file", name)
+		}
+		b, err := readOptionFile(path)
+		if err != nil {
+			return fmt.Errorf("bake: -%s: %v", name, err)
+		}
+		r.Files[path] = b
+	}
+	bakedFiles = r.Files
+
+	ruleArgs := flag.Args()
+	if *rulesFile != "" {
+		rs, err := readRules(*rulesFile)
+		if err != nil {
+			return fmt.Errorf("bake: %v", err)
+		}
+		ruleArgs = append(ruleArgs, rs...)
+	}
+	for _, s := range ruleArgs {
+		if _, err := newRule(s); err != nil {
+			return fmt.Errorf("bake: %v", err)
+		}
+	}
+	if _, err := optionRules(); err != nil {
+		return fmt.Errorf("bake: %v", err)
+	}
+	if *pipelineFile != "" {
+		if _, err := loadPipeline(*pipelineFile); err != nil {
+			return fmt.Errorf("bake: %v", err)
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(exe)
+	if err != nil {
+		return err
+	}
+	b, _ = splitBaked(b)
+
+	j, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.Write(b)
+	buf.Write(j)
+	binary.Write(&buf, binary.BigEndian, uint64(len(j)))
+	buf.WriteString(bakeMagic)
+	return os.WriteFile(out, buf.Bytes(), 0755)
+}
+
+// bakeOutput returns the file of the first -o in args, before or
+// after the rules, and the rest of args. A -o after it is an option
+// of the baked executable.
+func bakeOutput(args []string) (string, []string) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			break
+		}
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			continue
+		}
+		n, v, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if n == "o" {
+			rest := append([]string(nil), args[:i]...)
+			if !hasValue {
+				if i+1 == len(args) {
+					return "", args
+				}
+				v = args[i+1]
+				i++
+			}
+			return v, append(rest, args[i+1:]...)
+		}
+		if f := flag.Lookup(n); f != nil && !hasValue && !isBoolFlag(f) {
+			i++
+		}
+	}
+	return "", args
+}
+
+// splitBaked splits the executable b into the original
+// executable and the baked recipe, nil if there is none
+func splitBaked(b []byte) ([]byte, *recipe) {
+	if !bytes.HasSuffix(b, []byte(bakeMagic)) || len(b) < len(bakeMagic)+8 {
+		return b, nil
+	}
+	end := len(b) - len(bakeMagic)
+	n := binary.BigEndian.Uint64(b[end-8 : end])
+	if n > uint64(end-8) {
+		return b, nil
+	}
+	start := end - 8 - int(n)
+	r, err := parseRecipe(b[start : end-8])
+	if err != nil {
+		return b, nil
+	}
+	return b[:start], r
+}
+
+// parseRecipe parses a baked recipe, or the array of arguments
+// baked by older versions
+func parseRecipe(j []byte) (*recipe, error) {
+	var r recipe
+	if bytes.HasPrefix(bytes.TrimSpace(j), []byte("[")) {
+		err := json.Unmarshal(j, &r.Args)
+		return &r, err
+	}
+	err := json.Unmarshal(j, &r)
+	return &r, err
+}
+
+// loadBaked parses the options baked in the running executable and
+// keeps its rules in bakedRules and its files in bakedFiles. Options of the command line are
+// parsed later by flag.Parse and override them.
+func loadBaked() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.Size() < int64(len(bakeMagic)+8) {
+		return nil
+	}
+	tail := make([]byte, len(bakeMagic)+8)
+	if _, err := f.ReadAt(tail, fi.Size()-int64(len(tail))); err != nil {
+		return nil
+	}
+	if string(tail[8:]) != bakeMagic {
+		return nil
+	}
+
+	n := int64(binary.BigEndian.Uint64(tail[:8]))
+	if n < 0 || n > fi.Size()-int64(len(tail)) {
+		return errors.New("corrupted baked arguments")
+	}
+	j := make([]byte, n)
+	if _, err := f.ReadAt(j, fi.Size()-int64(len(tail))-n); err != nil {
+		return err
+	}
+	r, err := parseRecipe(j)
+	if err != nil {
+		return fmt.Errorf("corrupted baked arguments: %v", err)
+	}
+	if err := flag.CommandLine.Parse(r.Args); err != nil {
+		return err
+	}
+	bakedRules, bakedFiles = flag.Args(), r.Files
+	return nil
+}
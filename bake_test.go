@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBakeOutput(t *testing.T) {
+	tests := []struct {
+		args []string
+		out  string
+		rest []string
+	}{
+		{[]string{"-o", "x", "t:h1"}, "x", []string{"t:h1"}},
+		{[]string{"-rules", "r.txt", "-o", "x"}, "x", []string{"-rules", "r.txt"}},
+		{[]string{"-squash", "-o=x", "t:h1"}, "x", []string{"-squash", "t:h1"}},
+		{[]string{"t:h1", "-o", "x", "-o", "y"}, "x", []string{"t:h1", "-o", "y"}},
+		{[]string{"-resolve", "-o", "t:h1"}, "", []string{"-resolve", "-o", "t:h1"}},
+		{[]string{"--", "-o", "x"}, "", []string{"--", "-o", "x"}},
+		{[]string{"t:h1", "-o"}, "", []string{"t:h1", "-o"}},
+	}
+	for _, tt := range tests {
+		out, rest := bakeOutput(tt.args)
+		if out != tt.out || !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("bakeOutput(%q) = %q, %q, want %q, %q", tt.args, out, rest, tt.out, tt.rest)
+		}
+	}
+}
+
+func TestSplitBaked(t *testing.T) {
+	exe := []byte("\x7fELF...")
+	for _, trailer := range []string{
+		`{"args":["-rules","r.txt"],"files":{"r.txt":"dDpoMQo="}}`,
+		`["-rules","r.txt"]`,
+	} {
+		b := append(append([]byte(nil), exe...), trailer...)
+		b = append(b, 0, 0, 0, 0, 0, 0, 0, byte(len(trailer)))
+		b = append(b, bakeMagic...)
+		got, r := splitBaked(b)
+		if string(got) != string(exe) || r == nil {
+			t.Fatalf("splitBaked of %s: got %q, %v", trailer, got, r)
+		}
+		if !reflect.DeepEqual(r.Args, []string{"-rules", "r.txt"}) {
+			t.Errorf("splitBaked of %s: got args %q", trailer, r.Args)
+		}
+	}
+	if got, r := splitBaked(exe); string(got) != string(exe) || r != nil {
+		t.Errorf("splitBaked of an executable without recipe: got %q, %v", got, r)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// maxBody is the largest body of a page that humphrey reads
+var maxBody = byteSizeVar("max-body", 10<<20, "Fail urls with a body larger than `size`, like 512KB or 10MB, instead of reading it. 0 for no limit")
+
+// byteSize is a flag.Value for sizes in bytes with an optional
+// KB, MB or GB suffix, in units of 1024
+type byteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+func (b *byteSize) String() string {
+	for _, u := range byteUnits {
+		if *b != 0 && int64(*b)%u.size == 0 {
+			return strconv.FormatInt(int64(*b)/u.size, 10) + u.suffix
+		}
+	}
+	return "0"
+}
+
+func (b *byteSize) Set(s string) error {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	mul := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(t, u.suffix) {
+			t, mul = strings.TrimSpace(strings.TrimSuffix(t, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("bad size: %s", s)
+	}
+	*b = byteSize(n * mul)
+	return nil
+}
+
+// byteSizeVar defines a size flag with the given name, default and usage
+func byteSizeVar(name string, def byteSize, usage string) *byteSize {
+	b := &def
+	flag.Var(b, name, usage)
+	return b
+}
+
+// force makes humphrey parse pages that are not html
+var force = flag.Bool("force", false, "Parse pages even if their Content-Type or their first bytes show they are not html")
+
+// body is the body of a page, read by goquery straight from the
+// connection instead of being buffered whole, so that a huge response
+// or a link to a video fails after -max-body bytes instead of taking
+// all the memory. Closing it fills the fetchInfo of the page.
+type body struct {
+	resp    *http.Response
+	r       *bufio.Reader
+	closers []io.Closer
+	left    int64
+	start   time.Time
+	info    *fetchInfo
+}
+
+func newBody(resp *http.Response, start time.Time, info *fetchInfo) *body {
+	return &body{resp: resp, r: bufio.NewReader(resp.Body), left: int64(*maxBody), start: start, info: info}
+}
+
+// acceptEncoding are the content encodings that decode handles
+const acceptEncoding = "gzip, deflate, br"
+
+// decode makes b read the body decoded by its Content-Encoding. The
+// http client decodes only gzip, and only if it sent Accept-Encoding
+// itself, but some CDNs send brotli to every client. The decoded
+// bytes count against -max-body, so small bombs can't take the memory.
+func (b *body) decode() error {
+	ce := b.resp.Header.Get("Content-Encoding")
+	if ce == "" {
+		return nil
+	}
+	encs := strings.Split(ce, ",")
+	for i := len(encs) - 1; i >= 0; i-- {
+		r, c, err := decoder(encs[i], b.r)
+		if err != nil {
+			return &fetchError{fmt.Errorf("%v for url: %s", err, b.resp.Request.URL)}
+		}
+		if c != nil {
+			b.closers = append(b.closers, c)
+		}
+		if r != io.Reader(b.r) {
+			b.r = bufio.NewReader(r)
+		}
+	}
+	return nil
+}
+
+// decoder returns r decoded by the content encoding enc,
+// with a closer for the decoder if it needs one
+func decoder(enc string, r *bufio.Reader) (io.Reader, io.Closer, error) {
+	switch enc = strings.ToLower(strings.TrimSpace(enc)); enc {
+	case "identity", "":
+		return r, nil, nil
+	case "gzip", "x-gzip":
+		z, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad gzip body: %v", err)
+		}
+		return z, z, nil
+	case "deflate":
+		// deflate should be zlib but some servers send raw deflate
+		if h, err := r.Peek(2); err == nil && h[0]&0x0f == 8 && (uint(h[0])<<8|uint(h[1]))%31 == 0 {
+			z, err := zlib.NewReader(r)
+			if err != nil {
+				return nil, nil, fmt.Errorf("bad deflate body: %v", err)
+			}
+			return z, z, nil
+		}
+		f := flate.NewReader(r)
+		return f, f, nil
+	case "br":
+		return brotli.NewReader(r), nil, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported content encoding %s", enc)
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if *maxBody > 0 {
+		if b.left < 0 {
+			return 0, b.tooLarge()
+		}
+		if int64(len(p)) > b.left+1 {
+			p = p[:b.left+1]
+		}
+	}
+	n, err := b.r.Read(p)
+	b.left -= int64(n)
+	downloaded.Add(int64(n))
+	if *maxBody > 0 && b.left < 0 {
+		return n - int(-b.left), b.tooLarge()
+	}
+	if err != nil && err != io.EOF {
+		err = &fetchError{err}
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	if b.info != nil {
+		b.info.set(b.resp, b.start)
+	}
+	runMetrics.fetch(b.resp.StatusCode, time.Since(b.start))
+	for _, c := range b.closers {
+		c.Close()
+	}
+	return b.resp.Body.Close()
+}
+
+func (b *body) tooLarge() error {
+	return &fetchError{fmt.Errorf("body larger than -max-body %s for url: %s", maxBody, b.resp.Request.URL)}
+}
+
+// check returns an error for responses that are known to be too large
+// from their Content-Length or not to be html, before parsing their
+// body. Unless -force is set, a page is not html if its Content-Type
+// is not html, text/plain or application/octet-stream, which servers
+// use when they don't know better, or if its first bytes look like
+// something else, like a pdf or json, whatever its Content-Type says.
+//
+// check must be called after decode, as it reads the decoded bytes.
+func (b *body) check() error {
+	u := b.resp.Request.URL
+	if *maxBody > 0 && b.resp.ContentLength > int64(*maxBody) {
+		return &fetchError{fmt.Errorf("body of %d bytes is larger than -max-body %s for url: %s",
+			b.resp.ContentLength, maxBody, u)}
+	}
+	if *force {
+		return nil
+	}
+
+	ct := "none"
+	if h := b.resp.Header.Get("Content-Type"); h != "" {
+		ct = h
+		if mt, _, err := mime.ParseMediaType(h); err == nil {
+			ct = mt
+		}
+		switch ct {
+		case "text/html", "application/xhtml+xml", "text/plain", "application/octet-stream":
+		default:
+			return &fetchError{fmt.Errorf("content type %s is not html for url: %s, use -force to parse it anyway", ct, u)}
+		}
+	}
+
+	head, err := b.r.Peek(512)
+	if err != nil && err != io.EOF {
+		return &fetchError{err}
+	}
+	if sniffed := sniff(head); sniffed != "text/html" && sniffed != "text/xml" && sniffed != "text/plain" {
+		return &fetchError{fmt.Errorf("body looks like %s, not html, with content type %s for url: %s, use -force to parse it anyway",
+			sniffed, ct, u)}
+	}
+	return nil
+}
+
+// sniff returns the media type of a body from its first bytes with
+// the algorithm of browsers, that finds no json as it's never rendered
+func sniff(head []byte) string {
+	mt, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if mt == "text/plain" {
+		if t := bytes.TrimSpace(head); len(t) > 0 && (t[0] == '{' || t[0] == '[') {
+			return "application/json"
+		}
+	}
+	return mt
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var budget = flag.Duration("budget", 0, "Stop after this `duration`, like 5m, and write the results so far. 0 for no limit")
+var maxBytes = byteSizeVar("max-bytes", 0, "Stop after downloading pages of this total `size`, like 500MB, and write the results so far. 0 for no limit")
+var timeout = flag.Duration("timeout", 0, "Fail urls whose download takes longer than this `duration`. 0 for no limit")
+
+// runStart is when the run started, for -budget
+var runStart = time.Now()
+
+// downloaded counts the bytes of the bodies read, for -max-bytes
+var downloaded atomic.Int64
+
+var budgetOnce sync.Once
+
+// overBudget reports whether the run has used up -budget or -max-bytes.
+// Batches check it before each url and stop gracefully, writing the
+// results so far, so that a job from cron neither fills the disk nor
+// runs past its window. A url that is being downloaded is finished.
+func overBudget() bool {
+	var why string
+	switch {
+	case *budget > 0 && time.Since(runStart) > *budget:
+		why = "-budget " + budget.String()
+	case *maxBytes > 0 && downloaded.Load() > int64(*maxBytes):
+		why = "-max-bytes " + maxBytes.String()
+	default:
+		return false
+	}
+	budgetOnce.Do(func() {
+		slog.Warn("stopping, the budget is exhausted", "budget", why, "elapsed", time.Since(runStart).Round(time.Second).String(), "bytes", downloaded.Load())
+	})
+	return true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// errNotModified is returned by download when the server
+// answers a conditional request with http 304
+var errNotModified = errors.New("not modified")
+
+// resultCache is the extraction result cache of the run, nil if disabled
+var resultCache *cache
+
+// cache stores the results of applying a set of rules to a url, so
+// that re-running unchanged rules over unchanged pages is instant.
+// Pages are revalidated with conditional requests using their ETag
+// and Last-Modified and, if the server does not support them,
+// by comparing the hash of their body. Each entry is a json file
+// in dir named after the hash of the url and the rules.
+type cache struct {
+	dir string
+}
+
+// cacheEntry is a cached result with the validators of the page
+type cacheEntry struct {
+	URL          string                 `json:"url"`
+	ETag         string                 `json:"etag,omitempty"`
+	LastModified string                 `json:"last_modified,omitempty"`
+	BodyHash     string                 `json:"body_sha256"`
+	Result       map[string]interface{} `json:"result"`
+}
+
+func newCache(dir string) (*cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &cache{dir}, nil
+}
+
+// key returns the name of the cache entry for the rules on url u.
+// The global transforms, -remove, -final-key, the method and body
+// of the requests, the variants, -soft404, -empty and -stream change
+// the results so they are part of it.
+func (c *cache) key(u string, rules []*rule, as_array bool) string {
+	b, _ := json.Marshal(rules)
+	g, _ := json.Marshal([][]*transform{globalTransforms, finalTransforms})
+	v, _ := json.Marshal(variants)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%t\x00%s\x00%t\x00%s\x00%s\x00%t",
+		u, b, g, *removeSel, *finalKey, *method, reqBody, as_array, v, *soft404Check, *soft404Marker, *emptyPolicy, *streamParse))))
+}
+
+// get returns the entry for key k or nil if there is none
+func (c *cache) get(k string) *cacheEntry {
+	b, err := os.ReadFile(filepath.Join(c.dir, k+".json"))
+	if err != nil {
+		return nil
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil
+	}
+	return &e
+}
+
+// put stores the entry e with key k. The file is written
+// to a temporary name first so readers never see half entries.
+func (c *cache) put(k string, e *cacheEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(c.dir, k+".tmp")
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(c.dir, k+".json"))
+}
+
+// conditional returns the headers for a conditional request
+// that revalidates the page of the entry
+func (e *cacheEntry) conditional() http.Header {
+	if e == nil {
+		return nil
+	}
+	h := make(http.Header)
+	if e.ETag != "" {
+		h.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		h.Set("If-Modified-Since", e.LastModified)
+	}
+	return h
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var canonical = flag.Bool("canonical", false, "Normalize the urls before deduplication and output: lowercase host, no default port, fragment or tracking parameters and sorted query")
+var stripParams = flag.String("strip-params", "utm_*,fbclid,gclid,dclid,msclkid,yclid,mc_cid,mc_eid,_ga,_gl,igshid,ref_src", "the query `parameters` removed by -canonical, comma separated, with * for any suffix")
+
+// canonicalURL returns u normalized, so that the links to the same
+// page through different tracking links are the same url. The scheme
+// and the host are lowercased, default ports, the fragment and the
+// parameters of -strip-params are removed and the query is sorted by
+// name. Urls that can't be parsed are returned as they are.
+func canonicalURL(u string) string {
+	p, err := url.Parse(u)
+	if err != nil || p.Opaque != "" {
+		return u
+	}
+	p.Scheme = strings.ToLower(p.Scheme)
+	p.Host = strings.ToLower(p.Host)
+	if port := p.Port(); (p.Scheme == "http" && port == "80") || (p.Scheme == "https" && port == "443") {
+		p.Host = strings.TrimSuffix(p.Host, ":"+port)
+	}
+	if p.Path == "" && p.Host != "" {
+		p.Path = "/"
+	}
+	p.Fragment, p.RawFragment = "", ""
+
+	if p.RawQuery != "" {
+		q := p.Query()
+		for name := range q {
+			if stripParam(name) {
+				delete(q, name)
+			}
+		}
+		p.RawQuery = q.Encode()
+	}
+	p.ForceQuery = false
+	return p.String()
+}
+
+// stripParam reports whether the query parameter name is in -strip-params
+func stripParam(name string) bool {
+	for _, pat := range strings.Split(*stripParams, ",") {
+		if pat = strings.TrimSpace(pat); pat == "" {
+			continue
+		}
+		if ok, _ := path.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var maxRedirects = flag.Int("max-redirects", 10, "Fail urls that redirect more than `N` times")
+var noFollowRedirects = flag.Bool("no-follow-redirects", false, "Do not follow redirects. The page of the redirect is scraped and its Location is the final url")
+var finalKey = flag.String("final-key", "", "the `name` for the final url of the page, after redirects, in output map. Not included if empty")
+
+var acceptStatus = statusSetVar("accept-status", "Parse pages with these http `codes`, like 200,203,404 or 200-299, and fail the others (default 200)")
+
+// statusSet is a flag.Value for a set of http status codes
+// given as a comma separated list of codes and ranges
+type statusSet struct {
+	s     string
+	codes map[int]bool
+}
+
+func (ss *statusSet) String() string {
+	if ss == nil || ss.s == "" {
+		return "200"
+	}
+	return ss.s
+}
+
+func (ss *statusSet) Set(s string) error {
+	codes := make(map[int]bool)
+	for _, f := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(f), "-")
+		if !isRange {
+			hi = lo
+		}
+		l, err1 := strconv.Atoi(lo)
+		h, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || l < 100 || h > 599 || l > h {
+			return fmt.Errorf("bad http status: %s", f)
+		}
+		for c := l; c <= h; c++ {
+			codes[c] = true
+		}
+	}
+	ss.s, ss.codes = s, codes
+	return nil
+}
+
+// has reports whether code is in the set
+func (ss *statusSet) has(code int) bool {
+	if ss.codes == nil {
+		return code == http.StatusOK
+	}
+	return ss.codes[code]
+}
+
+// statusSetVar defines a status set flag with the given name and usage
+func statusSetVar(name, usage string) *statusSet {
+	ss := new(statusSet)
+	flag.Var(ss, name, usage)
+	return ss
+}
+
+var method = flag.String("method", "", "the http `method` of the requests. GET or, if there is a body, POST")
+var data = flag.String("data", "", "a form `body`, like q=term&page=2, for the requests, sent as application/x-www-form-urlencoded")
+var dataFile = flag.String("data-file", "", "a `file` with the body of the requests, sent like -data")
+var jsonBody = flag.String("json-body", "", "a json `body` for the requests, sent as application/json")
+
+// reqBody and reqType are the body of the requests and its
+// content type, from -data, -data-file or -json-body
+var reqBody []byte
+var reqType string
+
+// loadRequestBody sets the body of the requests from the options
+func loadRequestBody() error {
+	n := 0
+	for _, s := range []string{*data, *dataFile, *jsonBody} {
+		if s != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("only one of -data, -data-file and -json-body can be set")
+	}
+
+	switch {
+	case *data != "":
+		reqBody, reqType = []byte(*data), "application/x-www-form-urlencoded"
+	case *dataFile != "":
+		b, err := readOptionFile(*dataFile)
+		if err != nil {
+			return err
+		}
+		reqBody, reqType = b, "application/x-www-form-urlencoded"
+	case *jsonBody != "":
+		if !json.Valid([]byte(*jsonBody)) {
+			return errors.New("-json-body is not valid json")
+		}
+		reqBody, reqType = []byte(*jsonBody), "application/json"
+	}
+	return nil
+}
+
+// newRequest returns the request for url u with the method
+// and the body of the options
+func newRequest(u string) (*http.Request, error) {
+	m := strings.ToUpper(*method)
+	if m == "" {
+		m = "GET"
+		if reqBody != nil {
+			m = "POST"
+		}
+	}
+	var body io.Reader
+	if reqBody != nil {
+		body = bytes.NewReader(reqBody)
+	}
+	req, err := http.NewRequest(m, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if reqType != "" {
+		req.Header.Set("Content-Type", reqType)
+	}
+	return req, nil
+}
+
+var noSession = flag.Bool("no-session", false, "Send every request on its own, without the cookies set by previous responses and on a new connection")
+
+var caCert = flag.String("cacert", "", "a pem `file` with the certificates of the CAs to trust, besides those of the system, for sites with private CAs")
+var clientCert = flag.String("cert", "", "a pem `file` with the client certificate for sites that require mutual tls. Its key is in -cert-key or in the same file")
+var clientKey = flag.String("cert-key", "", "a pem `file` with the private key of -cert")
+var insecure = flag.Bool("insecure", false, "Do not verify the certificates of the sites. Only for testing")
+
+var resolveFlag = multiFlagVar("resolve", "Connect to `host:port:address` instead of the address of host, like curl. Can be repeated")
+
+// resolvePins parses the -resolve options into a map from
+// host:port to the address:port to connect to instead
+func resolvePins(opts []string) (map[string]string, error) {
+	pins := make(map[string]string)
+	for _, o := range opts {
+		host, rest, ok1 := strings.Cut(o, ":")
+		port, addr, ok2 := strings.Cut(rest, ":")
+		addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		if !ok1 || !ok2 || host == "" || net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("bad -resolve %s, expected host:port:address", o)
+		}
+		if _, err := strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("bad -resolve %s, expected host:port:address", o)
+		}
+		pins[strings.ToLower(net.JoinHostPort(host, port))] = net.JoinHostPort(addr, port)
+	}
+	return pins, nil
+}
+
+var unixSocket = flag.String("unix", "", "Connect to the unix socket at `path` for all the requests. The host of the urls is sent as the Host header")
+
+// client is the http client for all the downloads
+var client = &http.Client{CheckRedirect: checkRedirect}
+
+var delay = flag.Duration("delay", 0, "Wait this `duration`, like 500ms, between the requests, to not overload the sites")
+
+var paceMu sync.Mutex
+var lastRequest time.Time
+
+// pace waits until -delay has passed since the last request. Url
+// templates and pipelines can request hundreds of pages of a site.
+func pace() {
+	if *delay <= 0 {
+		return
+	}
+	paceMu.Lock()
+	defer paceMu.Unlock()
+	if wait := time.Until(lastRequest.Add(*delay)); wait > 0 {
+		time.Sleep(wait)
+	}
+	lastRequest = time.Now()
+}
+
+// setupClient configures client by the options. By default all the
+// requests of a run share a cookie jar and a pool of connections, like
+// a browser session, so that sites where a search sets the cookies
+// for its results and details can be scraped in one run.
+func setupClient() error {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if *noSession {
+		t.DisableKeepAlives = true
+	} else {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return err
+		}
+		client.Jar = jar
+	}
+	guard := *mcp && !*allowPrivate
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if guard {
+		d.Control = guardPrivate
+		if t.Proxy != nil {
+			t.Proxy = guardProxy(t.Proxy)
+		}
+	}
+	pins, err := resolvePins(*resolveFlag)
+	if err != nil {
+		return err
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if pin, ok := pins[strings.ToLower(addr)]; ok {
+			addr = pin
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+	if *unixSocket != "" {
+		// the socket is chosen by whoever runs humphrey, not by the urls
+		var ud net.Dialer
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return ud.DialContext(ctx, "unix", *unixSocket)
+		}
+	}
+	if err := setupTLS(t); err != nil {
+		return err
+	}
+	rt, err := setupProtocol(t, pins, guard)
+	if err != nil {
+		return err
+	}
+	if *harFile != "" {
+		rt = recordHAR(rt)
+	}
+	if *warcFile != "" {
+		if rt, err = recordWARC(rt); err != nil {
+			return err
+		}
+	}
+	if *hostConcurrency > 0 || *hostDelay > 0 {
+		rt = limitHosts(rt)
+	}
+	client.Transport = rt
+	client.Timeout = *timeout
+	return nil
+}
+
+// setupTLS configures the tls of t by -cacert, -cert, -cert-key
+// and -insecure
+func setupTLS(t *http.Transport) error {
+	if *caCert == "" && *clientCert == "" && *clientKey == "" && !*insecure {
+		return nil
+	}
+	conf := &tls.Config{InsecureSkipVerify: *insecure}
+	if *caCert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		b, err := os.ReadFile(*caCert)
+		if err != nil {
+			return err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("no certificates in -cacert %s", *caCert)
+		}
+		conf.RootCAs = pool
+	}
+	if *clientCert != "" {
+		key := *clientKey
+		if key == "" {
+			key = *clientCert
+		}
+		cert, err := tls.LoadX509KeyPair(*clientCert, key)
+		if err != nil {
+			return fmt.Errorf("-cert: %v", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	} else if *clientKey != "" {
+		return errors.New("-cert-key needs -cert")
+	}
+	t.TLSClientConfig = conf
+	return nil
+}
+
+// checkRedirect is the redirect policy of client, set by
+// -max-redirects and -no-follow-redirects
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if *noFollowRedirects {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > *maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", *maxRedirects)
+	}
+	return nil
+}
+
+// isRedirect reports whether resp is a redirect that was not followed
+func isRedirect(resp *http.Response) bool {
+	return resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != ""
+}
+
+// finalURL returns the url of the page of resp after redirects or,
+// if resp is a redirect that was not followed, its Location
+func finalURL(resp *http.Response) string {
+	if isRedirect(resp) {
+		if loc, err := resp.Location(); err == nil {
+			return loc.String()
+		}
+	}
+	return resp.Request.URL.String()
+}
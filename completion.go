@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// flagValues are the values of the options that take one of a few
+var flagValues = map[string][]string{
+	"key-order": {"sorted", "rules"},
+	"empty":     {"emit", "skip", "error"},
+	"sort":      {"asc", "desc"},
+	"visited":   {"exact", "bloom:"},
+}
+
+// completionFlag is an option as completed by the shells
+type completionFlag struct {
+	name, desc string
+	// kind is bool for options without a value, file or dir for
+	// those of a path, values for those of flagValues, profile for
+	// -p and value for the rest
+	kind   string
+	values []string
+}
+
+// completionFlags returns the options of humphrey for completion
+func completionFlags() []completionFlag {
+	var formats []string
+	for _, d := range formatDefs {
+		formats = append(formats, d.name)
+	}
+	var fs []completionFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		desc, _, _ := strings.Cut(usage, ". ")
+		c := completionFlag{name: f.Name, desc: desc, kind: "value"}
+		switch {
+		case isBoolFlag(f):
+			c.kind = "bool"
+		case f.Name == "p":
+			c.kind = "profile"
+		case f.Name == "format":
+			c.kind, c.values = "values", formats
+		case flagValues[f.Name] != nil:
+			c.kind, c.values = "values", flagValues[f.Name]
+		case name == "file" || name == "archive":
+			c.kind = "file"
+		case name == "dir" || name == "directory":
+			c.kind = "dir"
+		}
+		fs = append(fs, c)
+	})
+	return fs
+}
+
+// completion writes the completion script of shell, bash, zsh or fish,
+// for the options, their values, the commands and the profiles of the
+// config file, which the scripts get with humphrey completion profiles.
+// With profiles it writes the names of the profiles instead.
+func completion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		return bashCompletion(w)
+	case "zsh":
+		return zshCompletion(w)
+	case "fish":
+		return fishCompletion(w)
+	case "profiles":
+		names := make([]string, 0, len(profileNames))
+		names = append(names, profileNames...)
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(w, name)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown shell for completion: %s, not bash, zsh or fish", shell)
+}
+
+const listProfiles = "humphrey completion profiles 2>/dev/null"
+
+func bashCompletion(w io.Writer) error {
+	var names, files, dirs, values []string
+	var cases strings.Builder
+	for _, f := range completionFlags() {
+		names = append(names, "-"+f.name)
+		switch f.kind {
+		case "file":
+			files = append(files, "-"+f.name)
+		case "dir":
+			dirs = append(dirs, "-"+f.name)
+		case "values":
+			fmt.Fprintf(&cases, "\t-%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", f.name, strings.Join(f.values, " "))
+		case "profile":
+			fmt.Fprintf(&cases, "\t-%s) COMPREPLY=($(compgen -W \"$(%s)\" -- \"$cur\")); return ;;\n", f.name, listProfiles)
+		case "value":
+			values = append(values, "-"+f.name)
+		}
+	}
+	if len(files) > 0 {
+		fmt.Fprintf(&cases, "\t%s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", strings.Join(files, "|"))
+	}
+	if len(dirs) > 0 {
+		fmt.Fprintf(&cases, "\t%s) COMPREPLY=($(compgen -d -- \"$cur\")); return ;;\n", strings.Join(dirs, "|"))
+	}
+	if len(values) > 0 {
+		fmt.Fprintf(&cases, "\t%s) return ;;\n", strings.Join(values, "|"))
+	}
+	_, err := fmt.Fprintf(w, `# bash completion for humphrey, load with: source <(humphrey completion bash)
+_humphrey() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+	case "$prev" in
+%s	esac
+	if [[ "$cur" == -* ]]; then
+		COMPREPLY=($(compgen -W %q -- "$cur"))
+	elif [[ $COMP_CWORD -eq 1 ]]; then
+		COMPREPLY=($(compgen -W "%s $(%s)" -- "$cur"))
+	fi
+}
+complete -o default -F _humphrey humphrey
+`, cases.String(), strings.Join(names, " "), strings.Join(commands, " "), listProfiles)
+	return err
+}
+
+func zshCompletion(w io.Writer) error {
+	var specs strings.Builder
+	quote := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`)
+	for _, f := range completionFlags() {
+		spec := fmt.Sprintf("-%s[%s]", f.name, quote.Replace(f.desc))
+		switch f.kind {
+		case "file":
+			spec += ":file:_files"
+		case "dir":
+			spec += ":directory:_files -/"
+		case "values":
+			spec += fmt.Sprintf(":%s:(%s)", f.name, strings.Join(f.values, " "))
+		case "profile":
+			spec += fmt.Sprintf(`:profile:{compadd -- ${(f)"$(%s)"}}`, listProfiles)
+		case "value":
+			spec += ":" + f.name + ":"
+		}
+		fmt.Fprintf(&specs, "\t\t'%s' \\\n", spec)
+	}
+	_, err := fmt.Fprintf(w, `#compdef humphrey
+# zsh completion for humphrey, write it as _humphrey to a directory of $fpath
+_humphrey() {
+	local state
+	_arguments -s \
+%s		'*:: :->args'
+	if [[ $state == args ]] && (( CURRENT == 1 )); then
+		compadd -- %s ${(f)"$(%s)"}
+	fi
+}
+_humphrey "$@"
+`, specs.String(), strings.Join(commands, " "), listProfiles)
+	return err
+}
+
+func fishCompletion(w io.Writer) error {
+	quote := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+	fmt.Fprintln(w, "# fish completion for humphrey, load with: humphrey completion fish | source")
+	fmt.Fprintf(w, "complete -c humphrey -n __fish_is_first_arg -f -a '%s (%s)'\n", strings.Join(commands, " "), listProfiles)
+	for _, f := range completionFlags() {
+		line := fmt.Sprintf("complete -c humphrey -o %s -d '%s'", f.name, quote.Replace(f.desc))
+		switch f.kind {
+		case "file":
+			line += " -r -F"
+		case "dir":
+			line += " -x -a '(__fish_complete_directories)'"
+		case "values":
+			line += fmt.Sprintf(" -x -a '%s'", strings.Join(f.values, " "))
+		case "profile":
+			line += fmt.Sprintf(" -x -a '(%s)'", listProfiles)
+		case "value":
+			line += " -x"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var concurrency = flag.Int("concurrency", 1, "Scrape up to `N` urls at once. The results are written in the order of the urls")
+var hostConcurrency = flag.Int("host-concurrency", 0, "Send at most `N` requests at once to a host, whatever -concurrency is. 0 for no limit")
+var hostDelay = flag.Duration("host-delay", 0, "Wait this `duration` between the requests to the same host, whatever -concurrency is")
+
+// scrapeJob is a url scraped by scrapeAll with its result
+type scrapeJob struct {
+	u, label string
+	info     *fetchInfo
+	m        map[string]interface{}
+	err      error
+	done     chan struct{}
+}
+
+// scrapeAll scrapes the urls that next returns, until it returns nil,
+// with the rules, up to -concurrency at once, and calls handle with
+// the jobs in the order of next. A url is handled before the next one
+// is started if -concurrency is 1, like in a loop. It stops at the
+// first error of handle and returns it.
+func scrapeAll(next func() *scrapeJob, rules []*rule, asArray bool, handle func(*scrapeJob) error) error {
+	n := *concurrency
+	if n < 1 {
+		n = 1
+	}
+	// slots are taken when a url is started and freed when it is
+	// handled, so the results waiting their turn are bounded too
+	slots := make(chan struct{}, n)
+	jobs := make(chan *scrapeJob, n)
+	stop := make(chan struct{})
+	go func() {
+		defer close(jobs)
+		for {
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+			j := next()
+			if j == nil {
+				return
+			}
+			j.done = make(chan struct{})
+			go func() {
+				defer close(j.done)
+				j.m, j.err = downloadAndApplyRules(j.u, rules, asArray, j.info)
+			}()
+			jobs <- j
+		}
+	}()
+
+	for j := range jobs {
+		<-j.done
+		if err := handle(j); err != nil {
+			close(stop)
+			return err
+		}
+		<-slots
+	}
+	return nil
+}
+
+// hostLimiter is a transport that sends at most -host-concurrency
+// requests at once to a host and starts them -host-delay apart, so
+// that crawls of urls of many sites stay fast without hammering any
+// of them. A request holds its slot until its body is closed.
+type hostLimiter struct {
+	rt    http.RoundTripper
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	slots chan struct{}
+	mu    sync.Mutex
+	last  time.Time
+}
+
+func limitHosts(rt http.RoundTripper) http.RoundTripper {
+	return &hostLimiter{rt: rt, hosts: make(map[string]*hostSlots)}
+}
+
+func (l *hostLimiter) host(h string) *hostSlots {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	hs := l.hosts[h]
+	if hs == nil {
+		hs = &hostSlots{}
+		if *hostConcurrency > 0 {
+			hs.slots = make(chan struct{}, *hostConcurrency)
+		}
+		l.hosts[h] = hs
+	}
+	return hs
+}
+
+func (l *hostLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	hs := l.host(req.URL.Host)
+	if hs.slots != nil {
+		select {
+		case hs.slots <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	if *hostDelay > 0 {
+		hs.mu.Lock()
+		if wait := time.Until(hs.last.Add(*hostDelay)); wait > 0 {
+			time.Sleep(wait)
+		}
+		hs.last = time.Now()
+		hs.mu.Unlock()
+	}
+
+	resp, err := l.rt.RoundTrip(req)
+	if err != nil {
+		hs.release()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: hs.release}
+	return resp, nil
+}
+
+func (hs *hostSlots) release() {
+	if hs.slots != nil {
+		<-hs.slots
+	}
+}
+
+// releaseBody frees the slot of its host when it is closed
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+var configFile = flag.String("config", defaultConfigFile(), "Read the default options from the toml `file`, if it exists. Options on the command line override them")
+var profileName = flag.String("p", "", "Use the profile `name` of the config file, its options, rules and urls. The arguments are urls instead of rules")
+
+// commands are the first arguments that are commands, not profiles
+var commands = []string{"auto", "bake", "completion", "describe", "explore", "repl", "replay", "test", "validate"}
+
+// profileNames are the names of the profiles of the config file
+var profileNames []string
+
+// profile is the profile of the config file in use, nil if none
+var profile *siteProfile
+
+// siteProfile is a profile of the config file, a table with options,
+// rules and default urls, for the sites scraped again and again
+//
+//	[profile.hn]
+//	rules = ["title:.titleline > a", "link:.titleline > a:href"]
+//	url = "https://news.ycombinator.com"
+//	delay = "1s"
+//
+// used as humphrey -p hn, or humphrey hn, and humphrey -p hn url to
+// scrape other urls.
+type siteProfile struct {
+	name  string
+	rules []string
+	urls  []string
+	// positional is set if the profile was the first argument
+	positional bool
+}
+
+// defaultConfigFile returns the path of config.toml in the
+// configuration directory of the user, like ~/.config/humphrey
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "humphrey", "config.toml")
+}
+
+// loadConfig sets the options of the config file before those of the
+// command line, so that these override them. The file has a key for
+// each option, named after it without the dash, with a string, number
+// or boolean value, or an array of values for the options that can be
+// repeated, which are then added to those of the command line. A ~ at
+// the start of a string is the home directory.
+//
+//	timeout = "30s"
+//	cache = "~/.cache/humphrey"
+//	format = "yaml"
+//	strict = false
+//	sitemap = ["https://example.com/sitemap.xml"]
+//
+// The file is the one of -config, looked up on the command line,
+// or in HUMPHREY_CONFIG, before it is parsed.
+// A missing default file is not an error.
+func loadConfig() error {
+	path := *configFile
+	if v, ok := earlyOption("config"); ok {
+		path = v
+	}
+	if path == "" {
+		return nil
+	}
+
+	var opts map[string]interface{}
+	if _, err := toml.DecodeFile(path, &opts); err != nil {
+		if _, ok := earlyOption("p"); !ok && errors.Is(err, fs.ErrNotExist) && path == defaultConfigFile() {
+			return nil
+		}
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	profiles, _ := opts["profile"].(map[string]interface{})
+	delete(opts, "profile")
+	for name := range profiles {
+		profileNames = append(profileNames, name)
+	}
+	if err := setOptions(opts, nil); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	p := &siteProfile{}
+	if v, ok := earlyOption("p"); ok {
+		p.name = v
+	} else if v, ok := firstArg(os.Args[1:]); ok && profiles[v] != nil && !contains(commands, v) {
+		p.name, p.positional = v, true
+	}
+	if p.name == "" {
+		return nil
+	}
+	popts, ok := profiles[p.name].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: no profile %s", path, p.name)
+	}
+	if err := setOptions(popts, p); err != nil {
+		return fmt.Errorf("%s: profile %s: %v", path, p.name, err)
+	}
+	profile = p
+	return nil
+}
+
+// setOptions sets the options of opts in the order of their names.
+// The rules and url of a profile p are set to it.
+func setOptions(opts map[string]interface{}, p *siteProfile) error {
+	names := make([]string, 0, len(opts))
+	for name := range opts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var err error
+		switch {
+		case p != nil && name == "rules":
+			p.rules, err = stringList(opts[name])
+		case p != nil && name == "url":
+			p.urls, err = stringList(opts[name])
+		default:
+			err = setOption(name, opts[name])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stringList returns v, a toml string or array of strings, as a list
+func stringList(v interface{}) ([]string, error) {
+	if s, ok := v.(string); ok {
+		return []string{s}, nil
+	}
+	vs, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a string or an array of strings: %v", v)
+	}
+	var ss []string
+	for _, v := range vs {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("not a string: %v", v)
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+// args returns the urls to scrape with the profile, those of the
+// arguments, without the profile itself, or else the url of the profile
+func (p *siteProfile) args(args []string) []string {
+	if p.positional && len(args) > 0 {
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		return args
+	}
+	return p.urls
+}
+
+// setOption sets the flag name to v, a value of a toml document,
+// or to each of its elements if it is an array
+func setOption(name string, v interface{}) error {
+	if flag.Lookup(name) == nil || name == "config" || name == "p" {
+		return fmt.Errorf("unknown option: %s", name)
+	}
+	vs, ok := v.([]interface{})
+	if !ok {
+		vs = []interface{}{v}
+	}
+	for _, v := range vs {
+		s := fmt.Sprint(v)
+		if strings.HasPrefix(s, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				s = filepath.Join(home, s[2:])
+			}
+		}
+		if err := flag.Set(name, s); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// earlyOption returns the value of the option name, needed before
+// the command line is parsed, from it or from the environment
+func earlyOption(name string) (string, bool) {
+	if v, ok := argValue(os.Args[1:], name); ok {
+		return v, true
+	}
+	return os.LookupEnv(envName(name))
+}
+
+// argValue returns the value of the option name in args, the command
+// line, before it is parsed
+func argValue(args []string, name string) (string, bool) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" || !strings.HasPrefix(a, "-") || a == "-" {
+			break
+		}
+		a = strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+		n, v, hasValue := strings.Cut(a, "=")
+		if n == name {
+			if hasValue {
+				return v, true
+			}
+			if i+1 < len(args) {
+				return args[i+1], true
+			}
+			return "", false
+		}
+		// skip the value of the options that have one
+		if f := flag.Lookup(n); f != nil && !hasValue && !isBoolFlag(f) {
+			i++
+		}
+	}
+	return "", false
+}
+
+// firstArg returns the first argument of args that is not an option
+// or the value of one
+func firstArg(args []string) (string, bool) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			if i+1 < len(args) {
+				return args[i+1], true
+			}
+			return "", false
+		}
+		if a == "-" || !strings.HasPrefix(a, "-") {
+			return a, true
+		}
+		n, _, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if f := flag.Lookup(n); f != nil && !hasValue && !isBoolFlag(f) {
+			i++
+		}
+	}
+	return "", false
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	xhtml "golang.org/x/net/html"
+)
+
+// debugSamples is how many matches -debug-rules shows for each rule
+const debugSamples = 3
+
+// debugRules writes to w, for each rule and its alternatives, how many
+// elements the selector matched on the page of url u and the values
+// of the first few with their paths in the document. Values are shown
+// before the transforms. It is the first thing to look at when a rule
+// returns nothing.
+func debugRules(w io.Writer, doc *goquery.Document, u string, rules []*rule) {
+	fmt.Fprintf(w, "rules for url: %s\n", u)
+	for _, r := range rules {
+		for alt := r; alt != nil; alt = alt.Fallback {
+			debugRule(w, doc, alt)
+		}
+	}
+}
+
+func debugRule(w io.Writer, doc *goquery.Document, r *rule) {
+	desc := r.Selector
+	if r.Attribute != "" {
+		desc += ":" + r.Attribute
+	}
+
+	if strings.HasPrefix(r.Selector, "@") {
+		vals := r.match(doc)
+		fmt.Fprintf(w, "  %s %s: %d values\n", r.Name, desc, len(vals))
+		for i, v := range vals {
+			if i == debugSamples {
+				break
+			}
+			fmt.Fprintf(w, "    %s\n", debugValue(v))
+		}
+		return
+	}
+
+	s := doc.FindMatcher(compileSelector(r.Selector))
+	fmt.Fprintf(w, "  %s %s: %d elements\n", r.Name, desc, s.Length())
+	s.EachWithBreak(func(i int, e *goquery.Selection) bool {
+		if i == debugSamples {
+			return false
+		}
+		var v interface{}
+		if r.Attribute == "@table" {
+			v = table(r.exclude(e))
+		} else {
+			v = r.value(r.exclude(e))
+		}
+		fmt.Fprintf(w, "    %s  %s\n", domPath(e.Get(0)), debugValue(v))
+		return true
+	})
+}
+
+// debugValue returns v on one line, cut if it is long
+func debugValue(v interface{}) string {
+	s := markdownCell(v)
+	if r := []rune(s); len(r) > 80 {
+		s = string(r[:80]) + "..."
+	}
+	return fmt.Sprintf("%q", s)
+}
+
+// domPath returns the path of n from the html element, each element
+// with its id or first class and its position among the siblings
+// with the same tag if there are many
+func domPath(n *xhtml.Node) string {
+	var path []string
+	for e := n; e != nil && e.Type == xhtml.ElementNode; e = e.Parent {
+		seg := e.Data
+		if id := attrOf(e, "id"); id != "" {
+			seg += "#" + id
+		} else if cls := strings.Fields(attrOf(e, "class")); len(cls) > 0 {
+			seg += "." + cls[0]
+		}
+		pos, same := 0, 0
+		if e.Parent != nil {
+			for c := e.Parent.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == xhtml.ElementNode && c.Data == e.Data {
+					same++
+					if c == e {
+						pos = same
+					}
+				}
+			}
+		}
+		if same > 1 {
+			seg += fmt.Sprintf(":nth-of-type(%d)", pos)
+		}
+		path = append([]string{seg}, path...)
+	}
+	return strings.Join(path, " > ")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errDuplicate is returned for pages whose content
+// is in the deduplication window. They are skipped silently.
+var errDuplicate = errors.New("duplicate content")
+
+// dedup is the deduplication window of the run, nil if disabled.
+// dedupURL and dedupContent select what is deduplicated.
+var dedup *dedupWindow
+var dedupURL, dedupContent bool
+
+// dedupWindow remembers the most recent keys, urls or content hashes,
+// so that repeatedly submitted pages in an endless stream of urls
+// produce only one result. It holds at most size keys and,
+// if ttl is positive, forgets keys older than ttl.
+type dedupWindow struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	queue []dedupEntry
+	seen  map[string]time.Time
+}
+
+type dedupEntry struct {
+	key  string
+	when time.Time
+}
+
+func newDedupWindow(size int, ttl time.Duration) *dedupWindow {
+	return &dedupWindow{size: size, ttl: ttl, seen: make(map[string]time.Time)}
+}
+
+// check reports whether k is in the window and adds it if not
+func (w *dedupWindow) check(k string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	if w.ttl > 0 {
+		for len(w.queue) > 0 && now.Sub(w.queue[0].when) > w.ttl {
+			w.evict()
+		}
+	}
+	if _, ok := w.seen[k]; ok {
+		return true
+	}
+
+	w.seen[k] = now
+	w.queue = append(w.queue, dedupEntry{k, now})
+	for len(w.queue) > w.size {
+		w.evict()
+	}
+	return false
+}
+
+// evict forgets the oldest key
+func (w *dedupWindow) evict() {
+	delete(w.seen, w.queue[0].key)
+	w.queue = w.queue[1:]
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"strings"
+)
+
+// syntax documents a form of the command line syntax
+type syntax struct {
+	Syntax      string `json:"syntax"`
+	Description string `json:"description"`
+}
+
+// ruleSyntax lists the forms of a rule
+var ruleSyntax = []syntax{
+	{"key:selector[:attribute]", "the text of the elements matched by the css selector or the value of their attribute"},
+	{"key:selector[:attribute]||selector[:attribute]...", "alternatives tried in order until one matches"},
+	{"key:selector!exclude[:attribute]", "the matched elements without their descendants matched by the exclude selector"},
+	{"key:selector:{attribute,...}", "an object per matched element with a member for each attribute"},
+	{"key:selector:@table", "the rows of the matched tables as objects keyed by the header texts"},
+	{`key:"selector"[:attribute]`, "a selector in quotes, like \"a:first-child\", with colons that do not separate parts, or use -sep"},
+	{"key:@jsonld[:type]", "the JSON-LD blocks of the page or the objects of the type in them"},
+	{"key:@meta:name[*]", "the content of the meta tags with the property or name, or all of them with the prefix"},
+	{"key:@microdata[:itemtype]", "the top level microdata items of the page or the items of the itemtype"},
+	{"key:@article[:member]", "the main article of the page, like the reader mode of browsers, or a member of it"},
+}
+
+// keySyntax lists the modifiers that can follow the key of a rule
+var keySyntax = []syntax{
+	{"key[i] key[last] key[lo:hi]", "keep only the match at an index or a range of matches, negative indexes count from the end"},
+	{"key|transform key|transform(arg)", "convert the values, transforms can be chained"},
+	{`key#"description"`, "describe the result in the -schema"},
+	{"key!", "the rule is required, a page where it matches nothing fails and the exit code is non-zero"},
+	{`key?="value"`, "the result when the rule matches nothing, the quotes are optional for values without modifier characters"},
+	{"key{n} key{min,max} key{min,}", "the expected number of matches, violations are warnings or, with -assert, failures"},
+}
+
+// pseudoAttributes lists the attributes that extract
+// something other than the value of an html attribute
+var pseudoAttributes = []syntax{
+	{"@text", "the text of the element, the same as no attribute"},
+	{"@owntext", "the text of the element without the text of its children"},
+	{"@attrs", "an object with all the attributes of the element"},
+	{"@html", "the inner html of the element"},
+	{"@outerhtml", "the html of the element including its own tag"},
+	{"@table", "the rows of a table as objects keyed by the header texts"},
+}
+
+// builtinSelectors lists the selectors that are builtin
+// extractors instead of css selectors
+var builtinSelectors = []syntax{
+	{"@jsonld", "JSON-LD structured data, the attribute is an optional @type"},
+	{"@meta", "the content of meta tags, the attribute is a property or name, * for a prefix"},
+	{"@microdata", "schema.org microdata items, the attribute is an optional itemtype"},
+	{"@article", "the main article with title, byline, published, text and html, the attribute is an optional member"},
+}
+
+// outputFormats lists the ways the results can be written,
+// the formats of -format and the template of -tmpl
+var outputFormats = func() []syntax {
+	var fs []syntax
+	for _, d := range formatDefs {
+		fs = append(fs, d.syntax)
+	}
+	return append(fs, syntax{"template", "a text/template executed for each url, with -tmpl"})
+}()
+
+// flagDescription documents a command line flag
+type flagDescription struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+// description is the machine readable self description
+// of humphrey printed by the describe subcommand
+type description struct {
+	Usage      string            `json:"usage"`
+	Rules      []syntax          `json:"rules"`
+	Modifiers  []syntax          `json:"modifiers"`
+	Selectors  []syntax          `json:"selectors"`
+	Attributes []syntax          `json:"attributes"`
+	Transforms []syntax          `json:"transforms"`
+	Presets    []syntax          `json:"presets"`
+	Formats    []syntax          `json:"formats"`
+	Flags      []flagDescription `json:"flags"`
+}
+
+// describe writes to w the json description of the rule syntax,
+// output formats and flags so wrappers can build command lines
+// programmatically. The flags are taken from the flag package,
+// so the description always matches the binary.
+func describe(w io.Writer) error {
+	var transforms []syntax
+	for _, t := range transformDefs {
+		transforms = append(transforms, t.syntax)
+	}
+
+	d := description{
+		Usage:      "humphrey [options] [rules]",
+		Rules:      ruleSyntax,
+		Modifiers:  keySyntax,
+		Selectors:  builtinSelectors,
+		Attributes: pseudoAttributes,
+		Transforms: transforms,
+		Presets:    []syntax{{"humphrey auto [url...]", "applies the rules " + strings.Join(autoRules, " ")}},
+		Formats:    outputFormats,
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		typ, usage := flag.UnquoteUsage(f)
+		if typ == "" {
+			typ = "bool"
+		}
+		d.Flags = append(d.Flags, flagDescription{f.Name, typ, f.DefValue, usage})
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if prettyJSON() {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(d)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// descriptor describes an element picked visually in the browser,
+// with the devtools "copy selector" or the bookmarklet of the README.
+// Description, Unit and Tags annotate the rule in the -schema.
+// Other members of the exported objects, like the sample text, are ignored.
+type descriptor struct {
+	Name        string   `json:"name"`
+	Selector    string   `json:"selector"`
+	Attribute   string   `json:"attribute"`
+	Description string   `json:"description"`
+	Unit        string   `json:"unit"`
+	Tags        []string `json:"tags"`
+}
+
+// loadDescriptors reads a json array of element descriptors
+// from the file at path and converts them to rules.
+// Descriptors without name are named field1, field2, etc.
+func loadDescriptors(path string) ([]*rule, error) {
+	b, err := readOptionFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ds []descriptor
+	if err := json.Unmarshal(b, &ds); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var rules []*rule
+	for i, d := range ds {
+		if strings.TrimSpace(d.Selector) == "" {
+			return nil, fmt.Errorf("%s: descriptor %d has no selector", path, i+1)
+		}
+		name := strings.TrimSpace(d.Name)
+		if name == "" {
+			name = fmt.Sprintf("field%d", i+1)
+		}
+		rules = append(rules, &rule{
+			Name:        name,
+			Selector:    strings.TrimSpace(d.Selector),
+			Attribute:   strings.TrimSpace(d.Attribute),
+			Description: d.Description,
+			Unit:        d.Unit,
+			Tags:        d.Tags,
+		})
+	}
+	return rules, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envName returns the environment variable of the option name,
+// like HUMPHREY_MAX_BODY for max-body
+func envName(name string) string {
+	return "HUMPHREY_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// loadEnv sets the options from their HUMPHREY_ environment variables.
+// They override the config file and are overridden by the command line.
+// Options that can be repeated get a single value.
+func loadEnv() error {
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || err != nil || f.Name == "config" || f.Name == "p" {
+			return
+		}
+		if e := flag.Set(f.Name, v); e != nil {
+			err = fmt.Errorf("%s: %v", envName(f.Name), e)
+		}
+	})
+	return err
+}
+
+// secret returns s or, if it is env:NAME, the value of the environment
+// variable NAME, so that passwords and tokens need not be on the
+// command line, where they are seen in process listings and shell
+// history, or in files
+func secret(s string) (string, error) {
+	name, ok := strings.CutPrefix(s, "env:")
+	if !ok {
+		return s, nil
+	}
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return v, nil
+}
+
+// resolveSecrets replaces the values env:NAME of the options that
+// carry credentials, like -db, with the environment variables
+func resolveSecrets() error {
+	for _, f := range []struct {
+		name string
+		v    *string
+	}{{"data", data}, {"json-body", jsonBody}, {"db", dbURL}} {
+		v, err := secret(*f.v)
+		if err != nil {
+			return fmt.Errorf("-%s: %v", f.name, err)
+		}
+		*f.v = v
+	}
+	return nil
+}
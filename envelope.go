@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// fetchInfo is the provenance of a result for -meta: where the page
+// was fetched from after redirects, its status, when and how long
+// it took and the sha256 of its body.
+type fetchInfo struct {
+	FinalURL  string
+	Status    int
+	FetchedAt time.Time
+	Duration  time.Duration
+	SHA256    string
+}
+
+// set fills info from the response resp of a request sent at start,
+// after its body has been read
+func (info *fetchInfo) set(resp *http.Response, start time.Time) {
+	info.FinalURL = finalURL(resp)
+	info.Status = resp.StatusCode
+	info.FetchedAt = start.UTC()
+	info.Duration = time.Since(start)
+}
+
+// envelope returns the result m of url u wrapped with its provenance
+func (info *fetchInfo) envelope(u string, m map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"url":         u,
+		"final_url":   info.FinalURL,
+		"status":      info.Status,
+		"fetched_at":  info.FetchedAt.Format(time.RFC3339Nano),
+		"duration_ms": info.Duration.Milliseconds(),
+		"sha256":      info.SHA256,
+		"data":        m,
+	}
+}
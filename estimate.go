@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// estimateSample is the maximum number of urls probed with HEAD
+// requests when estimating the cost of a job
+const estimateSample = 10
+
+// estimation is the predicted cost of running the rules on a list of urls
+// Requests is the number of pages that will be downloaded.
+// Bytes is the expected total size of the downloads, extrapolated
+// from the Content-Length of the sampled urls. Duration is the
+// expected wall time, extrapolated from the latency of the samples
+// and -concurrency, and at least the pacing of -delay, -host-delay
+// and -host-concurrency.
+type estimation struct {
+	Requests int    `json:"requests"`
+	Sampled  int    `json:"sampled"`
+	Failed   int    `json:"failed"`
+	Bytes    int64  `json:"bytes"`
+	Duration string `json:"duration"`
+}
+
+// estimate probes up to estimateSample urls, evenly spread over the list,
+// with HEAD requests and extrapolates the cost of downloading all of them
+// The requests are sent like those of the job, with the client and
+// the variants of the options and paced by -delay.
+// Urls that do not report a Content-Length are excluded
+// from the bandwidth extrapolation.
+func estimate(urls []string) *estimation {
+	e := &estimation{Requests: len(urls)}
+	if len(urls) == 0 {
+		return e
+	}
+
+	step := 1
+	if len(urls) > estimateSample {
+		step = len(urls) / estimateSample
+	}
+
+	var size int64
+	var sized int
+	var elapsed time.Duration
+	for i := 0; i < len(urls) && e.Sampled < estimateSample; i += step {
+		e.Sampled++
+		req, err := http.NewRequest("HEAD", urls[i], nil)
+		if err != nil {
+			e.Failed++
+			continue
+		}
+		if v := variantFor(req.URL); v != nil {
+			v.apply(req)
+		}
+		pace()
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			e.Failed++
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			e.Failed++
+			continue
+		}
+		elapsed += time.Since(start)
+		if n, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+			size += n
+			sized++
+		}
+	}
+
+	if sized > 0 {
+		e.Bytes = size / int64(sized) * int64(len(urls))
+	}
+	var latency time.Duration
+	if ok := e.Sampled - e.Failed; ok > 0 {
+		latency = elapsed / time.Duration(ok)
+	}
+	e.Duration = estimateDuration(urls, latency).Round(time.Second).String()
+	return e
+}
+
+// estimateDuration returns the wall time of downloading the urls, each
+// taking latency, -concurrency at once, but no faster than -delay
+// between all the requests and -host-delay and -host-concurrency allow
+// for the requests of each host
+func estimateDuration(urls []string, latency time.Duration) time.Duration {
+	n := *concurrency
+	if n < 1 {
+		n = 1
+	}
+	d := latency * time.Duration(len(urls)) / time.Duration(n)
+	if paced := *delay * time.Duration(len(urls)-1); paced > d {
+		d = paced
+	}
+
+	hosts := make(map[string]int)
+	for _, u := range urls {
+		if pu, err := url.Parse(u); err == nil {
+			hosts[pu.Host]++
+		}
+	}
+	for _, k := range hosts {
+		if paced := *hostDelay * time.Duration(k-1); paced > d {
+			d = paced
+		}
+		if *hostConcurrency > 0 {
+			if limited := latency * time.Duration(k) / time.Duration(*hostConcurrency); limited > d {
+				d = limited
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEstimateDuration(t *testing.T) {
+	saved := [...]interface{}{*concurrency, *delay, *hostDelay, *hostConcurrency}
+	defer func() {
+		*concurrency, *delay = saved[0].(int), saved[1].(time.Duration)
+		*hostDelay, *hostConcurrency = saved[2].(time.Duration), saved[3].(int)
+	}()
+
+	var urls []string
+	for i := 0; i < 8; i++ {
+		urls = append(urls, fmt.Sprintf("https://a.example.com/%d", i))
+	}
+	urls = append(urls, "https://b.example.com/1", "https://b.example.com/2")
+
+	for _, tc := range []struct {
+		concurrency     int
+		delay           time.Duration
+		hostDelay       time.Duration
+		hostConcurrency int
+		want            time.Duration
+	}{
+		{1, 0, 0, 0, 10 * time.Second},
+		{5, 0, 0, 0, 2 * time.Second},
+		{5, 2 * time.Second, 0, 0, 18 * time.Second},
+		{5, 0, 3 * time.Second, 0, 21 * time.Second},
+		{10, 0, 0, 2, 4 * time.Second},
+	} {
+		*concurrency, *delay = tc.concurrency, tc.delay
+		*hostDelay, *hostConcurrency = tc.hostDelay, tc.hostConcurrency
+		if got := estimateDuration(urls, time.Second); got != tc.want {
+			t.Errorf("%+v: got %v, want %v", tc, got, tc.want)
+		}
+	}
+}
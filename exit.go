@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// The exit codes of humphrey, so that shell pipelines
+// can branch on what went wrong
+const (
+	exitOK = 0
+	// exitUsage is for bad options or rules and other errors
+	// that stop humphrey before or outside scraping, like fatal
+	exitUsage = 1
+	// exitNetwork is for a url that failed to download, with -strict
+	exitNetwork = 2
+	// exitEmpty is for a page where rules failed, a required rule
+	// matched nothing, all the rules did with -empty error or a count
+	// was violated with -assert, with -strict. Also for a score
+	// lower than -min-quality and fixtures of humphrey test whose
+	// results changed.
+	exitEmpty = 3
+	// exitPartial is for a batch that went on after failed urls,
+	// without -strict, or stopped by -budget or -max-bytes, and for
+	// the files of -route that could not be written in full
+	exitPartial = 4
+)
+
+// errPartial is returned by batches, like pipelines,
+// that went on after failed urls
+var errPartial = errors.New("some urls failed")
+
+// fetchError is the error of a url that failed to download, a network
+// error, an http status not in -accept-status or a body that is too large
+// or not html
+type fetchError struct {
+	err error
+}
+
+func (e *fetchError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fetchError) Unwrap() error {
+	return e.err
+}
+
+// exitCodeOf returns the exit code for err, the error of a url
+func exitCodeOf(err error) int {
+	var fe *fetchError
+	if errors.As(err, &fe) {
+		return exitNetwork
+	}
+	return exitEmpty
+}
+
+// fatalURL logs err, the error of a url, and exits with its code
+func fatalURL(err error) {
+	slog.Error(err.Error())
+	exit(exitCodeOf(err))
+}
+
+// atExit are run once before humphrey exits, also on errors, for
+// outputs like -har that are needed most when something failed
+var atExit []func()
+
+var atExitOnce sync.Once
+
+// runAtExit runs atExit, the first time it is called
+func runAtExit() {
+	atExitOnce.Do(func() {
+		for _, f := range atExit {
+			f()
+		}
+	})
+}
+
+// exit runs atExit and exits with code
+func exit(code int) {
+	runAtExit()
+	os.Exit(code)
+}
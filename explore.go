@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	tea "github.com/charmbracelet/bubbletea"
+	xhtml "golang.org/x/net/html"
+)
+
+// explore downloads the page of url u and shows its elements as a tree
+// in the terminal. Moving to an element shows a selector that matches
+// it and a ready to paste rule, which is written to stdout on enter.
+func explore(u string) error {
+	r, _, err := download(u, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return err
+	}
+	doc.Url = r.resp.Request.URL
+
+	m := &explorer{doc: doc, open: make(map[*xhtml.Node]bool), height: 24}
+	body := doc.Find("body").Get(0)
+	if body == nil {
+		return fmt.Errorf("no body in url: %s", u)
+	}
+	m.root = body
+	m.open[body] = true
+	m.refresh()
+
+	res, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithOutput(os.Stderr)).Run()
+	if err != nil {
+		return err
+	}
+	if rl := res.(*explorer).chosen; rl != "" {
+		fmt.Println(rl)
+	}
+	return nil
+}
+
+// explorer is the bubbletea model of explore
+type explorer struct {
+	doc    *goquery.Document
+	root   *xhtml.Node
+	open   map[*xhtml.Node]bool
+	lines  []exploreLine
+	cursor int
+	top    int
+	height int
+	attr   int
+	chosen string
+}
+
+// exploreLine is an element shown in the tree at depth
+type exploreLine struct {
+	n     *xhtml.Node
+	depth int
+}
+
+// refresh recomputes the visible lines from the open elements
+func (m *explorer) refresh() {
+	m.lines = m.lines[:0]
+	var walk func(n *xhtml.Node, depth int)
+	walk = func(n *xhtml.Node, depth int) {
+		m.lines = append(m.lines, exploreLine{n, depth})
+		if !m.open[n] {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == xhtml.ElementNode && c.Data != "script" && c.Data != "style" {
+				walk(c, depth+1)
+			}
+		}
+	}
+	walk(m.root, 0)
+	if m.cursor >= len(m.lines) {
+		m.cursor = len(m.lines) - 1
+	}
+}
+
+func (m *explorer) Init() tea.Cmd {
+	return nil
+}
+
+func (m *explorer) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		prev, cur := m.cursor, m.lines[m.cursor].n
+		switch msg.String() {
+		case "q", "ctrl+c", "esc":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.lines)-1 {
+				m.cursor++
+			}
+		case "right", "l":
+			m.open[cur] = true
+			m.refresh()
+		case "left", "h":
+			if m.open[cur] && cur != m.root {
+				m.open[cur] = false
+				m.refresh()
+			} else if cur != m.root {
+				for i := m.cursor - 1; i >= 0; i-- {
+					if m.lines[i].n == cur.Parent {
+						m.cursor = i
+						break
+					}
+				}
+			}
+		case "a", "tab":
+			m.attr = (m.attr + 1) % len(exploreAttrs(cur))
+		case "enter":
+			m.chosen = m.rule(cur)
+			return m, tea.Quit
+		}
+		if m.cursor != prev {
+			m.attr = 0
+		}
+	}
+
+	view := m.height - 5
+	if view < 1 {
+		view = 1
+	}
+	if m.cursor < m.top {
+		m.top = m.cursor
+	} else if m.cursor >= m.top+view {
+		m.top = m.cursor - view + 1
+	}
+	return m, nil
+}
+
+func (m *explorer) View() string {
+	var b strings.Builder
+	view := m.height - 5
+	if view < 1 {
+		view = 1
+	}
+	for i := m.top; i < len(m.lines) && i < m.top+view; i++ {
+		l := m.lines[i]
+		mark := "  "
+		if i == m.cursor {
+			mark = "> "
+		}
+		fold := " "
+		if l.n.FirstChild != nil && hasElements(l.n) {
+			fold = "+"
+			if m.open[l.n] {
+				fold = "-"
+			}
+		}
+		fmt.Fprintf(&b, "%s%s%s %s\n", mark, strings.Repeat("  ", l.depth), fold, exploreLabel(l.n))
+	}
+
+	cur := m.lines[m.cursor].n
+	sel, _ := uniqueSelector(m.doc, cur)
+	fmt.Fprintf(&b, "\nselector: %s\nrule:     %s\n", sel, m.rule(cur))
+	b.WriteString("arrows move/open/close, a next attribute, enter print rule, q quit")
+	return b.String()
+}
+
+// rule returns the rule for the element n with the current attribute
+func (m *explorer) rule(n *xhtml.Node) string {
+	sel, index := uniqueSelector(m.doc, n)
+	key := "value"
+	if index >= 0 {
+		key += fmt.Sprintf("[%d]", index)
+	}
+	s := key + ":" + sel
+	if attr := exploreAttrs(n)[m.attr]; attr != "" {
+		s += ":" + attr
+	}
+	return s
+}
+
+// exploreAttrs returns the attributes that rules can extract from n,
+// the text first
+func exploreAttrs(n *xhtml.Node) []string {
+	attrs := []string{""}
+	for _, a := range n.Attr {
+		if a.Key != "class" && a.Key != "style" {
+			attrs = append(attrs, a.Key)
+		}
+	}
+	return append(attrs, "@html")
+}
+
+// exploreLabel returns the line of n in the tree, its tag with
+// id and classes and the beginning of its text
+func exploreLabel(n *xhtml.Node) string {
+	label := "<" + n.Data
+	for _, a := range n.Attr {
+		if a.Key == "id" || a.Key == "class" {
+			label += fmt.Sprintf(" %s=%q", a.Key, a.Val)
+		}
+	}
+	label += ">"
+	text := strings.Join(strings.Fields(goquery.NewDocumentFromNode(n).Text()), " ")
+	if len(text) > 60 {
+		text = text[:60] + "..."
+	}
+	return label + " " + text
+}
+
+func hasElements(n *xhtml.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == xhtml.ElementNode {
+			return true
+		}
+	}
+	return false
+}
+
+// cssIdentRe matches ids and classes that need no escaping in selectors
+var cssIdentRe = regexp.MustCompile(`^-?[_a-zA-Z][_a-zA-Z0-9-]*$`)
+
+// uniqueSelector returns a short css selector for n, adding parents
+// until it matches only n. Selectors in rules can't have pseudo
+// classes like :nth-child, so if no selector matches only n, it returns
+// the shortest that matches the fewest elements and the index of n
+// among them, for a [i] slice. Otherwise the index is -1.
+func uniqueSelector(doc *goquery.Document, n *xhtml.Node) (string, int) {
+	var sel, best string
+	var bestMatches *goquery.Selection
+	for e := n; e != nil && e.Type == xhtml.ElementNode; e = e.Parent {
+		seg := e.Data
+		if id := attrOf(e, "id"); cssIdentRe.MatchString(id) && doc.Find("#"+id).Length() == 1 {
+			seg = "#" + id
+		} else {
+			for _, c := range strings.Fields(attrOf(e, "class")) {
+				if cssIdentRe.MatchString(c) {
+					seg += "." + c
+				}
+			}
+		}
+		if sel == "" {
+			sel = seg
+		} else {
+			sel = seg + " > " + sel
+		}
+
+		matches := doc.Find(sel)
+		if matches.Length() == 1 {
+			return sel, -1
+		}
+		if bestMatches == nil || matches.Length() < bestMatches.Length() {
+			best, bestMatches = sel, matches
+		}
+		if strings.HasPrefix(seg, "#") || e.Data == "body" {
+			break
+		}
+	}
+	return best, bestMatches.IndexOfNode(n)
+}
+
+func attrOf(n *xhtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// feedFormat writes the results as an rss, atom or json feed, for sites that
+// don't have one. The rules named by -feed-item become the title, link,
+// date and description of the items. Rules with many values, like the
+// entries of a list page, give an item for each value and rules with a
+// single value are the same for all the items of the page. Relative
+// links are resolved against the url. The feed is written on close.
+type feedFormat struct {
+	w      io.Writer
+	kind   string
+	fields map[string]string
+	link   string
+	items  []feedItem
+}
+
+// feedItem is an entry of the feed
+type feedItem struct {
+	title, link, description string
+	date                     time.Time
+}
+
+func newRSSFormat(w io.Writer, rules []*rule) (formatter, error) {
+	return newFeedFormat(w, "rss")
+}
+
+func newAtomFormat(w io.Writer, rules []*rule) (formatter, error) {
+	return newFeedFormat(w, "atom")
+}
+
+func newJSONFeedFormat(w io.Writer, rules []*rule) (formatter, error) {
+	return newFeedFormat(w, "jsonfeed")
+}
+
+func newFeedFormat(w io.Writer, kind string) (formatter, error) {
+	f := &feedFormat{w: w, kind: kind, fields: map[string]string{
+		"title": "title", "link": "link", "date": "date", "description": "description",
+	}}
+	for _, kv := range strings.Split(*feedItemRules, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if _, known := f.fields[k]; !ok || !known || v == "" {
+			return nil, fmt.Errorf("bad -feed-item: %s", kv)
+		}
+		f.fields[k] = v
+	}
+	return f, nil
+}
+
+func (f *feedFormat) write(m map[string]interface{}) error {
+	u := fmt.Sprint(m[*key])
+	if f.link == "" {
+		f.link = u
+	}
+	base, _ := url.Parse(u)
+
+	for _, v := range itemValues(m, f.fields) {
+		it := feedItem{
+			title:       strings.Join(strings.Fields(v["title"]), " "),
+			link:        v["link"],
+			description: v["description"],
+		}
+		if it.title == "" && it.link == "" {
+			continue
+		}
+		if it.link != "" && base != nil {
+			if ref, err := url.Parse(it.link); err == nil {
+				it.link = base.ResolveReference(ref).String()
+			}
+		}
+		it.date, _ = itemDate(v["date"])
+		f.items = append(f.items, it)
+	}
+	return nil
+}
+
+// itemValues returns the items of the result m for formats like feeds.
+// fields maps the fields of the items to rule names. Rules with many
+// values give an item for each value and rules with a single value
+// are the same for all the items.
+func itemValues(m map[string]interface{}, fields map[string]string) []map[string]string {
+	n := 1
+	for _, r := range fields {
+		if vs, ok := m[r].([]interface{}); ok && len(vs) > n {
+			n = len(vs)
+		}
+	}
+	items := make([]map[string]string, n)
+	for i := range items {
+		items[i] = make(map[string]string)
+		for field, r := range fields {
+			v := m[r]
+			if vs, ok := v.([]interface{}); ok {
+				v = nil
+				if i < len(vs) {
+					v = vs[i]
+				}
+			}
+			if v != nil {
+				items[i][field] = strings.TrimSpace(fmt.Sprint(v))
+			}
+		}
+	}
+	return items
+}
+
+// itemDate parses the date of an item like |date
+func itemDate(s string) (time.Time, error) {
+	d, err := toDate(s, "")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, d.(string))
+}
+
+func (f *feedFormat) close() error {
+	if f.link == "" {
+		return errors.New("no urls for the feed")
+	}
+	title := *feedTitle
+	if title == "" {
+		title = f.link
+	}
+
+	if f.kind == "jsonfeed" {
+		enc := json.NewEncoder(f.w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(f.jsonFeed(title))
+	}
+
+	var doc interface{}
+	if f.kind == "atom" {
+		doc = f.atomFeed(title)
+	} else {
+		doc = f.rssFeed(title)
+	}
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f.w, "%s%s\n", xml.Header, b)
+	return err
+}
+
+// rss is an rss 2.0 feed
+type rss struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel struct {
+		Title       string    `xml:"title"`
+		Link        string    `xml:"link"`
+		Description string    `xml:"description"`
+		Generator   string    `xml:"generator"`
+		Items       []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title,omitempty"`
+	Link        string   `xml:"link,omitempty"`
+	GUID        *rssGUID `xml:"guid,omitempty"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Description string   `xml:"description,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+func (f *feedFormat) rssFeed(title string) *rss {
+	feed := &rss{Version: "2.0"}
+	feed.Channel.Title = title
+	feed.Channel.Link = f.link
+	feed.Channel.Description = "Scraped from " + f.link
+	feed.Channel.Generator = "humphrey"
+	for _, it := range f.items {
+		item := rssItem{Title: it.title, Link: it.link, Description: it.description}
+		if it.link != "" {
+			item.GUID = &rssGUID{true, it.link}
+		}
+		if !it.date.IsZero() {
+			item.PubDate = it.date.Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return feed
+}
+
+// atom is an atom feed
+type atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string    `xml:"title"`
+	ID      string    `xml:"id"`
+	Link    *atomLink `xml:"link,omitempty"`
+	Updated string    `xml:"updated"`
+	Summary string    `xml:"summary,omitempty"`
+}
+
+// atomFeed returns the atom feed. Atom requires an id and an update
+// time for every entry, so entries without a link get the url of the
+// feed with their index and entries without a date the time of the
+// latest entry, or now if none has a date.
+func (f *feedFormat) atomFeed(title string) *atom {
+	var updated time.Time
+	for _, it := range f.items {
+		if it.date.After(updated) {
+			updated = it.date
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now().UTC()
+	}
+
+	feed := &atom{Title: title, ID: f.link, Link: atomLink{f.link}, Author: "humphrey",
+		Updated: updated.Format(time.RFC3339)}
+	for i, it := range f.items {
+		e := atomEntry{Title: it.title, ID: it.link, Summary: it.description, Updated: feed.Updated}
+		if it.link != "" {
+			e.Link = &atomLink{it.link}
+		} else {
+			e.ID = fmt.Sprintf("%s#%d", f.link, i+1)
+		}
+		if !it.date.IsZero() {
+			e.Updated = it.date.Format(time.RFC3339)
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	return feed
+}
+
+// jsonFeed is a JSON Feed 1.1
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url,omitempty"`
+	Title         string `json:"title,omitempty"`
+	ContentText   string `json:"content_text"`
+	DatePublished string `json:"date_published,omitempty"`
+}
+
+// jsonFeed returns the json feed. Like in atom, items without
+// a link have the url of the feed with their index as id.
+func (f *feedFormat) jsonFeed(title string) *jsonFeed {
+	feed := &jsonFeed{Version: "https://jsonfeed.org/version/1.1", Title: title,
+		HomePageURL: f.link, Items: []jsonFeedItem{}}
+	for i, it := range f.items {
+		item := jsonFeedItem{ID: it.link, URL: it.link, Title: it.title, ContentText: it.description}
+		if it.link == "" {
+			item.ID = fmt.Sprintf("%s#%d", f.link, i+1)
+		}
+		if !it.date.IsZero() {
+			item.DatePublished = it.date.Format(time.RFC3339)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
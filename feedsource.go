@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+var feedFlag = multiFlagVar("feed", "Scrape the pages linked by the entries of the rss, atom or json feed at `url`. Can be repeated")
+var feedMeta = flag.Bool("feed-meta", false, "Add the title and the date of the entry of -feed to the result of its page, as feed_title and feed_date")
+
+// feedDoc is an rss 2.0, rss 1.0 or atom feed. Only the local names of
+// the elements are matched, so dc:date is the date of rss 1.0.
+type feedDoc struct {
+	XMLName xml.Name
+	Channel struct {
+		Items []feedEntry `xml:"item"`
+	} `xml:"channel"`
+	Items   []feedEntry `xml:"item"`
+	Entries []feedEntry `xml:"entry"`
+}
+
+type feedEntry struct {
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"link"`
+	GUID      string `xml:"guid"`
+	PubDate   string `xml:"pubDate"`
+	Date      string `xml:"date"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+}
+
+// link returns the link of the entry to its page
+func (e *feedEntry) link() string {
+	for _, l := range e.Links {
+		if l.Href != "" && (l.Rel == "" || l.Rel == "alternate") {
+			return l.Href
+		}
+		if t := strings.TrimSpace(l.Text); t != "" {
+			return t
+		}
+	}
+	if g := strings.TrimSpace(e.GUID); strings.HasPrefix(g, "http") {
+		return g
+	}
+	return ""
+}
+
+func (e *feedEntry) date() string {
+	for _, d := range []string{e.PubDate, e.Published, e.Date, e.Updated} {
+		if d = strings.TrimSpace(d); d != "" {
+			return d
+		}
+	}
+	return ""
+}
+
+// feedLink is a page linked by a feed with the metadata of its entry
+type feedLink struct {
+	url, title, date string
+}
+
+// feedURLs returns the pages of the entries of the feeds at roots, in
+// order and without duplicates, and the metadata of their entries by
+// url. Relative links are resolved against the url of the feed.
+func feedURLs(roots []string) ([]string, map[string]map[string]interface{}, error) {
+	var urls []string
+	meta := make(map[string]map[string]interface{})
+	for _, u := range roots {
+		links, err := loadFeed(u)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, l := range links {
+			if _, ok := meta[l.url]; ok {
+				continue
+			}
+			m := map[string]interface{}{"feed_title": l.title, "feed_date": nil}
+			if l.date != "" {
+				if d, err := toDate(l.date, ""); err == nil {
+					m["feed_date"] = d
+				} else {
+					m["feed_date"] = l.date
+				}
+			}
+			meta[l.url] = m
+			urls = append(urls, l.url)
+		}
+	}
+	return urls, meta, nil
+}
+
+// loadFeed downloads and parses the feed at u
+func loadFeed(u string) ([]feedLink, error) {
+	base, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	b, err := fetchResource(u)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	br := bufio.NewReader(b)
+
+	var links []feedLink
+	add := func(link, title, date string) {
+		if link = strings.TrimSpace(link); link == "" {
+			return
+		}
+		l, err := base.Parse(link)
+		if err != nil {
+			slog.Error("bad link in feed", "url", u, "link", link)
+			return
+		}
+		links = append(links, feedLink{l.String(), strings.TrimSpace(title), date})
+	}
+
+	if head, _ := br.Peek(512); bytes.HasPrefix(bytes.TrimLeft(head, "\ufeff \t\r\n"), []byte("{")) {
+		var jf struct {
+			Items []struct {
+				URL           string `json:"url"`
+				ExternalURL   string `json:"external_url"`
+				Title         string `json:"title"`
+				DatePublished string `json:"date_published"`
+			} `json:"items"`
+		}
+		if err := json.NewDecoder(br).Decode(&jf); err != nil {
+			return nil, fmt.Errorf("bad json feed: %v for url: %s", err, u)
+		}
+		for _, it := range jf.Items {
+			link := it.URL
+			if link == "" {
+				link = it.ExternalURL
+			}
+			add(link, it.Title, it.DatePublished)
+		}
+		return links, nil
+	}
+
+	var doc feedDoc
+	dec := xml.NewDecoder(br)
+	dec.CharsetReader = charset.NewReaderLabel
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("bad feed: %v for url: %s", err, u)
+	}
+	switch doc.XMLName.Local {
+	case "rss", "RDF", "feed":
+	default:
+		return nil, fmt.Errorf("not a feed but %s for url: %s", doc.XMLName.Local, u)
+	}
+	entries := append(append(doc.Channel.Items, doc.Items...), doc.Entries...)
+	for _, e := range entries {
+		add(e.link(), e.Title, e.date())
+	}
+	return links, nil
+}
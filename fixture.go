@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// fixture is a page saved by -record with the result of
+// the rules on it, to catch changes of the results later
+type fixture struct {
+	URL    string                 `json:"url"`
+	Arrays bool                   `json:"arrays"`
+	Result map[string]interface{} `json:"result"`
+}
+
+// record saves the page body of url u and its result m in dir,
+// as name.html and name.json where name is from the hash of u
+func record(dir, u string, body []byte, m map[string]interface{}, as_array bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%x", sha256.Sum256([]byte(u)))[:16])
+	if err := os.WriteFile(name+".html", body, 0644); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(&fixture{u, as_array, m}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name+".json", append(b, '\n'), 0644)
+}
+
+// runFixtures applies the rules to the pages saved in dir and
+// compares the results with the saved ones. It writes a line for
+// each fixture to w, with the members that changed, and
+// returns the number of fixtures that failed.
+func runFixtures(dir string, rules []*rule, w io.Writer) (int, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	if len(names) == 0 {
+		return 0, fmt.Errorf("no fixtures in %s", dir)
+	}
+
+	failed := 0
+	for _, name := range names {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return failed, err
+		}
+		var fx fixture
+		if err := json.Unmarshal(b, &fx); err != nil {
+			return failed, fmt.Errorf("%s: %v", name, err)
+		}
+		body, err := os.ReadFile(name[:len(name)-len(".json")] + ".html")
+		if err != nil {
+			return failed, err
+		}
+
+		m, err := extract(context.Background(), fx.URL, fx.URL, bytes.NewReader(body), rules, fx.Arrays)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s\n    %v\n", fx.URL, err)
+			continue
+		}
+		// compare through json, like the saved result
+		b, _ = json.Marshal(m)
+		var got map[string]interface{}
+		json.Unmarshal(b, &got)
+
+		diff := diffResults(fx.Result, got)
+		if len(diff) == 0 {
+			fmt.Fprintf(w, "ok   %s\n", fx.URL)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL %s\n", fx.URL)
+		for _, d := range diff {
+			fmt.Fprintf(w, "    %s\n", d)
+		}
+	}
+	fmt.Fprintf(w, "%d fixtures, %d failed\n", len(names), failed)
+	return failed, nil
+}
+
+// diffResults describes the members that differ in want and got
+func diffResults(want, got map[string]interface{}) []string {
+	keys := make(map[string]bool)
+	for k := range want {
+		keys[k] = true
+	}
+	for k := range got {
+		keys[k] = true
+	}
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var diff []string
+	for _, k := range sorted {
+		w, wok := want[k]
+		g, gok := got[k]
+		switch {
+		case !gok:
+			diff = append(diff, fmt.Sprintf("%s: missing", k))
+		case !wok:
+			diff = append(diff, fmt.Sprintf("%s: new", k))
+		case !reflect.DeepEqual(w, g):
+			wb, _ := json.Marshal(w)
+			gb, _ := json.Marshal(g)
+			diff = append(diff, fmt.Sprintf("%s: was %s, now %s", k, wb, gb))
+		}
+	}
+	return diff
+}
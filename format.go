@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// formatter writes results in an output format. Formats that
+// can't be streamed, like parquet, write everything on close.
+type formatter interface {
+	write(m map[string]interface{}) error
+	close() error
+}
+
+// formatDef is an output format selected with -format. The
+// rules of the command line decide the columns of tabular formats.
+type formatDef struct {
+	syntax
+	name string
+	new  func(w io.Writer, rules []*rule) (formatter, error)
+}
+
+// formatDefs lists the output formats. describe and
+// usage show them from here so keep it documented.
+var formatDefs = []formatDef{
+	{syntax{"json", "one json object per url, the default"}, "json", newJSONFormat},
+	{syntax{"parquet", "a parquet file with a row per url and columns typed by the transforms of the rules"}, "parquet", newParquetFormat},
+	{syntax{"yaml", "a yaml document per url, with the members in the order of the rules and their descriptions as comments"}, "yaml", newYAMLFormat},
+	{syntax{"toml", "a [[result]] table per url"}, "toml", newTOMLFormat},
+	{syntax{"markdown", "a section per url with bullet lists and tables, for issues and wikis"}, "markdown", newMarkdownFormat},
+	{syntax{"rss", "an rss feed with the items of -feed-item, for sites without one"}, "rss", newRSSFormat},
+	{syntax{"atom", "an atom feed with the items of -feed-item, for sites without one"}, "atom", newAtomFormat},
+	{syntax{"jsonfeed", "a JSON Feed 1.1 with the items of -feed-item"}, "jsonfeed", newJSONFeedFormat},
+	{syntax{"ics", "an iCalendar with an event for each value of the rules named event.title, event.start, event.end, event.location, event.description and event.url"}, "ics", newICSFormat},
+	{syntax{"xlsx", "an excel workbook with a row per url, or a sheet per url with -sheet-per-url"}, "xlsx", newXLSXFormat},
+}
+
+// newFormatter returns the formatter of the format name writing to w
+func newFormatter(name string, w io.Writer, rules []*rule) (formatter, error) {
+	for _, d := range formatDefs {
+		if d.name == name {
+			return d.new(w, rules)
+		}
+	}
+	return nil, fmt.Errorf("unknown format: %s", name)
+}
+
+// resultKeys returns the keys of m in the order of the rules, the
+// url key first, and then any other keys, like those of a pipeline
+// without rules, sorted
+func resultKeys(m map[string]interface{}, rules []*rule) []string {
+	var ks []string
+	if _, ok := m[*key]; ok {
+		ks = append(ks, *key)
+	}
+	for _, r := range rules {
+		if _, ok := m[r.Name]; ok && !contains(ks, r.Name) {
+			ks = append(ks, r.Name)
+		}
+	}
+	var rest []string
+	for k := range m {
+		if !contains(ks, k) {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(ks, rest...)
+}
+
+// jsonFormat writes a json object per result. With -key-order rules
+// the members are in the order of the rules instead of sorted.
+type jsonFormat struct {
+	enc   *json.Encoder
+	rules []*rule
+}
+
+func newJSONFormat(w io.Writer, rules []*rule) (formatter, error) {
+	switch *keyOrder {
+	case "sorted":
+		rules = nil
+	case "rules":
+	default:
+		return nil, fmt.Errorf("unknown -key-order: %s", *keyOrder)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if prettyJSON() {
+		enc.SetIndent("", "  ")
+	}
+	return &jsonFormat{enc, rules}, nil
+}
+
+func (f *jsonFormat) write(m map[string]interface{}) error {
+	if f.rules == nil {
+		return f.enc.Encode(m)
+	}
+	return f.enc.Encode(orderedResult{m, resultKeys(m, f.rules)})
+}
+
+func (f *jsonFormat) close() error {
+	return nil
+}
+
+// orderedResult is a result encoded with its members in the order of keys
+type orderedResult struct {
+	m    map[string]interface{}
+	keys []string
+}
+
+func (o orderedResult) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	b.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if err := enc.Encode(k); err != nil {
+			return nil, err
+		}
+		b.WriteByte(':')
+		if err := enc.Encode(o.m[k]); err != nil {
+			return nil, err
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// prettyJSON tells if json should be indented, with -pretty unless -compact
+func prettyJSON() bool {
+	return *pretty && !*compact
+}
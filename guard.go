@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+)
+
+var allowPrivate = flag.Bool("allow-private", false, "Let -mcp download pages from loopback, private and link-local addresses")
+
+// guardPrivate refuses connections to loopback, private, link-local
+// and unspecified addresses. It is the Control of the dialer of
+// client with -mcp, where the urls come from others, so that they
+// can't make humphrey fetch internal services or cloud metadata.
+// Checking the address on connect, after resolving, also stops
+// hostnames that resolve to such addresses.
+func guardPrivate(network, address string, c syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("refusing to connect to %s: %v", address, err)
+	}
+	return guardAddr(ap.Addr())
+}
+
+// guardAddr returns an error if ip is a loopback, private,
+// link-local or unspecified address
+func guardAddr(ip netip.Addr) error {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || cgnat.Contains(ip) {
+		return fmt.Errorf("refusing to connect to private address %s, see -allow-private", ip)
+	}
+	return nil
+}
+
+// guardProxy wraps proxy, the Proxy of the transport of client with
+// -mcp. Requests through a proxy connect to the proxy and not to
+// their host, so guardPrivate can't see where they go. The host of
+// those requests is resolved and checked before they are sent.
+func guardProxy(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		u, err := proxy(req)
+		if u == nil || err != nil {
+			return u, err
+		}
+		ips, err := net.DefaultResolver.LookupNetIP(req.Context(), "ip", req.URL.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			if err := guardAddr(ip); err != nil {
+				return nil, err
+			}
+		}
+		return u, nil
+	}
+}
+
+// cgnat is the shared address space of carrier-grade NAT, private too
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestGuardProxy(t *testing.T) {
+	proxyURL, _ := url.Parse("http://proxy.example.com:3128")
+	proxy := guardProxy(func(req *http.Request) (*url.URL, error) {
+		if req.URL.Host == "10.0.0.1" {
+			return nil, nil
+		}
+		return proxyURL, nil
+	})
+	for _, tc := range []struct {
+		url string
+		ok  bool
+	}{
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://192.168.1.1:8080/", false},
+		{"http://[::1]/", false},
+		{"https://93.184.216.34/", true},
+		{"http://10.0.0.1/", true},
+	} {
+		req, _ := http.NewRequest("GET", tc.url, nil)
+		u, err := proxy(req)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: got %v, %v", tc.url, u, err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var harFile = flag.String("har", "", "Record the http traffic of the run, the requests and responses with their headers, timings and bodies, in a HAR `file`")
+
+// harRecorder is a transport that records the requests sent through
+// rt and their responses as the entries of a HAR, the format of the
+// network panel of browsers, so that what humphrey got from a site can
+// be compared with what a browser got. Redirects and the requests
+// of -login are entries too.
+type harRecorder struct {
+	rt      http.RoundTripper
+	mu      sync.Mutex
+	entries []*harEntry
+}
+
+// The types of HAR 1.2, http://www.softwareishard.com/blog/har-12-spec/
+type harLog struct {
+	Log struct {
+		Version string      `json:"version"`
+		Creator harCreator  `json:"creator"`
+		Entries []*harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+
+	start   time.Time
+	headers time.Time
+	body    *tapBody
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harNV      `json:"cookies"`
+	Headers     []harNV      `json:"headers"`
+	QueryString []harNV      `json:"queryString"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int        `json:"status"`
+	StatusText  string     `json:"statusText"`
+	HTTPVersion string     `json:"httpVersion"`
+	Cookies     []harNV    `json:"cookies"`
+	Headers     []harNV    `json:"headers"`
+	Content     harContent `json:"content"`
+	RedirectURL string     `json:"redirectURL"`
+	HeadersSize int        `json:"headersSize"`
+	BodySize    int        `json:"bodySize"`
+}
+
+type harNV struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size        int    `json:"size"`
+	Compression int    `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// tapBody records the body of a response as it is read, for -har
+// and -warc. If closed is set it is called when the body is closed.
+type tapBody struct {
+	io.ReadCloser
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	done   time.Time
+	eof    bool
+	closed func(*tapBody)
+}
+
+func (b *tapBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	b.buf.Write(p[:n])
+	if err != nil {
+		b.done = time.Now()
+		b.eof = err == io.EOF
+	}
+	b.mu.Unlock()
+	return n, err
+}
+
+func (b *tapBody) Close() error {
+	b.mu.Lock()
+	if b.done.IsZero() {
+		b.done = time.Now()
+	}
+	b.mu.Unlock()
+	err := b.ReadCloser.Close()
+	if b.closed != nil {
+		b.closed(b)
+	}
+	return err
+}
+
+func (h *harRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := &harEntry{start: time.Now()}
+	e.StartedDateTime = e.start.Format(time.RFC3339Nano)
+	e.Request = harRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Cookies:     harCookies(req.Cookies()),
+		Headers:     harHeaders(req.Header),
+		QueryString: []harNV{},
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			e.Request.QueryString = append(e.Request.QueryString, harNV{k, v})
+		}
+	}
+	if req.GetBody != nil {
+		if r, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(r)
+			e.Request.PostData = &harPostData{req.Header.Get("Content-Type"), string(b)}
+			e.Request.BodySize = len(b)
+		}
+	}
+	h.mu.Lock()
+	h.entries = append(h.entries, e)
+	h.mu.Unlock()
+
+	resp, err := h.rt.RoundTrip(req)
+	e.headers = time.Now()
+	e.Timings.Wait = ms(e.headers.Sub(e.start))
+	if err != nil {
+		e.Error = err.Error()
+		e.Response = harResponse{Cookies: []harNV{}, Headers: []harNV{}, HeadersSize: -1, BodySize: -1}
+		return nil, err
+	}
+	e.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		HTTPVersion: resp.Proto,
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     harHeaders(resp.Header),
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+	}
+	e.body = &tapBody{ReadCloser: resp.Body}
+	resp.Body = e.body
+	return resp, nil
+}
+
+// content fills the content of the response of e from the body read so
+// far. It is decoded by its Content-Encoding and, if it's not text,
+// encoded in base64.
+func (e *harEntry) content() {
+	e.Time = e.Timings.Wait
+	if e.body == nil {
+		return
+	}
+	e.body.mu.Lock()
+	raw := append([]byte(nil), e.body.buf.Bytes()...)
+	done := e.body.done
+	e.body.mu.Unlock()
+
+	hdr := make(http.Header)
+	for _, nv := range e.Response.Headers {
+		hdr.Add(nv.Name, nv.Value)
+	}
+	b := raw
+	if ce := hdr.Get("Content-Encoding"); ce != "" {
+		encs := strings.Split(ce, ",")
+		var r io.Reader = bytes.NewReader(raw)
+		for i := len(encs) - 1; i >= 0; i-- {
+			d, _, err := decoder(encs[i], bufio.NewReader(r))
+			if err != nil {
+				break
+			}
+			r = d
+		}
+		if d, _ := io.ReadAll(r); len(d) > 0 {
+			b = d
+		}
+	}
+
+	e.Response.BodySize = len(raw)
+	e.Response.Content = harContent{Size: len(b), Compression: len(b) - len(raw), MimeType: hdr.Get("Content-Type")}
+	if utf8.Valid(b) {
+		e.Response.Content.Text = string(b)
+	} else {
+		e.Response.Content.Text = base64.StdEncoding.EncodeToString(b)
+		e.Response.Content.Encoding = "base64"
+	}
+	if !done.IsZero() {
+		e.Timings.Receive = ms(done.Sub(e.headers))
+		e.Time = ms(done.Sub(e.start))
+	}
+}
+
+// write writes the entries recorded to the file at path
+func (h *harRecorder) write(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var l harLog
+	l.Log.Version = "1.2"
+	l.Log.Creator = harCreator{"humphrey", "1.0.0"}
+	l.Log.Entries = h.entries
+	if l.Log.Entries == nil {
+		l.Log.Entries = []*harEntry{}
+	}
+	for _, e := range h.entries {
+		e.content()
+	}
+	b, err := json.MarshalIndent(&l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// recordHAR makes rt record the traffic and write it
+// to the file of -har when humphrey exits
+func recordHAR(rt http.RoundTripper) http.RoundTripper {
+	h := &harRecorder{rt: rt}
+	atExit = append(atExit, func() {
+		if err := h.write(*harFile); err != nil {
+			slog.Error("can't write -har", "error", err)
+		}
+	})
+	return h
+}
+
+func harHeaders(h http.Header) []harNV {
+	nvs := []harNV{}
+	for k, vs := range h {
+		for _, v := range vs {
+			nvs = append(nvs, harNV{k, v})
+		}
+	}
+	return nvs
+}
+
+func harCookies(cs []*http.Cookie) []harNV {
+	nvs := []harNV{}
+	for _, c := range cs {
+		nvs = append(nvs, harNV{c.Name, c.Value})
+	}
+	return nvs
+}
+
+// ms returns d in milliseconds, the unit of the times of HAR
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
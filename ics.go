@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// icsFields are the fields of the events of -format ics. Rules
+// named event.title, event.start and so on give their values.
+var icsFields = []string{"title", "start", "end", "location", "description", "url"}
+
+// icsFormat writes the results as an iCalendar with a VEVENT for each
+// event of the pages, for importing venue and meetup listings into a
+// calendar. Like feeds, rules with many values give an event for each
+// value. Dates are parsed like |date does and dates without a time
+// are all day events. Events without a start date are left out.
+type icsFormat struct {
+	w       io.Writer
+	fields  map[string]string
+	stamp   string
+	started bool
+}
+
+func newICSFormat(w io.Writer, rules []*rule) (formatter, error) {
+	f := &icsFormat{w: w, fields: make(map[string]string), stamp: time.Now().UTC().Format("20060102T150405Z")}
+	for _, field := range icsFields {
+		f.fields[field] = "event." + field
+	}
+	return f, nil
+}
+
+func (f *icsFormat) begin() error {
+	if f.started {
+		return nil
+	}
+	f.started = true
+	return f.lines("BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//humphrey//EN", "CALSCALE:GREGORIAN")
+}
+
+func (f *icsFormat) write(m map[string]interface{}) error {
+	if err := f.begin(); err != nil {
+		return err
+	}
+	u := fmt.Sprint(m[*key])
+	base, _ := url.Parse(u)
+
+	for _, v := range itemValues(m, f.fields) {
+		start, ok := icsDate("DTSTART", v["start"])
+		if !ok {
+			continue
+		}
+		uid := sha1.Sum([]byte(u + "\x00" + v["title"] + "\x00" + v["start"] + "\x00" + v["location"]))
+		lines := []string{
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%x@humphrey", uid[:10]),
+			"DTSTAMP:" + f.stamp,
+			start,
+		}
+		if end, ok := icsDate("DTEND", v["end"]); ok {
+			lines = append(lines, end)
+		}
+		for _, p := range []struct{ name, field string }{{"SUMMARY", "title"}, {"LOCATION", "location"}, {"DESCRIPTION", "description"}} {
+			if s := v[p.field]; s != "" {
+				lines = append(lines, p.name+":"+icsText(s))
+			}
+		}
+		if link := v["url"]; link != "" && base != nil {
+			if ref, err := url.Parse(link); err == nil {
+				lines = append(lines, "URL:"+base.ResolveReference(ref).String())
+			}
+		}
+		lines = append(lines, "END:VEVENT")
+		if err := f.lines(lines...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *icsFormat) close() error {
+	if err := f.begin(); err != nil {
+		return err
+	}
+	return f.lines("END:VCALENDAR")
+}
+
+// lines writes the content lines, folded at 75 octets and ended by CRLF
+func (f *icsFormat) lines(lines ...string) error {
+	var b strings.Builder
+	for _, l := range lines {
+		// continuation lines start with a space
+		for max := 75; len(l) > max; max = 74 {
+			cut := max
+			for cut > 0 && l[cut]&0xc0 == 0x80 {
+				cut--
+			}
+			b.WriteString(l[:cut] + "\r\n ")
+			l = l[cut:]
+		}
+		b.WriteString(l + "\r\n")
+	}
+	_, err := io.WriteString(f.w, b.String())
+	return err
+}
+
+// icsDate returns the property name with the date s, a date value
+// if s has no time, a time in UTC if s has a zone or offset, or else
+// a floating time, the same wall clock time in any zone, as the
+// listings of local events usually give
+func icsDate(name, s string) (string, bool) {
+	t, err := itemDate(s)
+	if err != nil {
+		return "", false
+	}
+	if !strings.Contains(s, ":") && t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return name + ";VALUE=DATE:" + t.Format("20060102"), true
+	}
+	if !hasZone(s) {
+		return name + ":" + t.Format("20060102T150405"), true
+	}
+	return name + ":" + t.UTC().Format("20060102T150405Z"), true
+}
+
+// hasZone reports whether the date s, in one of dateLayouts,
+// has a time zone or offset
+func hasZone(s string) bool {
+	s = strings.TrimSpace(s)
+	for _, l := range dateLayouts {
+		if _, err := time.Parse(l, s); err == nil {
+			return strings.Contains(l, "Z07") || strings.Contains(l, "-0700") || strings.Contains(l, "MST")
+		}
+	}
+	return false
+}
+
+// icsText escapes s for a text property
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestICSDate(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"2026-05-01", "DTSTART;VALUE=DATE:20260501"},
+		{"2026-05-01T19:00", "DTSTART:20260501T190000"},
+		{"2026-05-01 19:00:30", "DTSTART:20260501T190030"},
+		{"2026-05-01T19:00:00Z", "DTSTART:20260501T190000Z"},
+		{"2026-05-01T19:00:00+02:00", "DTSTART:20260501T170000Z"},
+		{"Fri, 01 May 2026 19:00:00 -0400", "DTSTART:20260501T230000Z"},
+	} {
+		got, ok := icsDate("DTSTART", tc.in)
+		if !ok || got != tc.want {
+			t.Errorf("icsDate(%q) = %q, %v, want %q", tc.in, got, ok, tc.want)
+		}
+	}
+	if _, ok := icsDate("DTSTART", "soon"); ok {
+		t.Errorf("icsDate(soon) is ok")
+	}
+}
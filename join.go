@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// joiner merges the results of different urls that share
+// the value of a field, for example a SKU found both in
+// a listing page and in the detail page of a product.
+// Results are kept in memory until all urls are scraped.
+type joiner struct {
+	field   string
+	urlKey  string
+	records []map[string]interface{}
+	index   map[string]map[string]interface{}
+}
+
+func newJoiner(field, urlKey string) *joiner {
+	return &joiner{
+		field:  field,
+		urlKey: urlKey,
+		index:  make(map[string]map[string]interface{}),
+	}
+}
+
+// add merges m into the record with the same join field. If there
+// is none, or m does not have the field, m starts a new record.
+// With -fold fields that differ only in case or accents are the same.
+// When merging, the first non-null value of a member wins
+// and the urls are collected in an array.
+func (j *joiner) add(m map[string]interface{}) {
+	k, ok := joinKey(m[j.field])
+	if !ok {
+		j.records = append(j.records, m)
+		return
+	}
+	k = compareKey(k)
+
+	rec, exists := j.index[k]
+	if !exists {
+		j.index[k] = m
+		j.records = append(j.records, m)
+		return
+	}
+	for name, v := range m {
+		switch {
+		case name == j.urlKey:
+			rec[name] = appendURL(rec[name], v)
+		case rec[name] == nil:
+			rec[name] = v
+		}
+	}
+}
+
+// appendURL adds the url v to the url or urls in old
+func appendURL(old, v interface{}) interface{} {
+	switch old := old.(type) {
+	case nil:
+		return v
+	case []interface{}:
+		return append(old, v)
+	default:
+		return []interface{}{old, v}
+	}
+}
+
+// joinKey returns the value of the join field as a string.
+// For arrays, like those produced by -arrays, it uses the first element.
+func joinKey(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, v != ""
+	case []interface{}:
+		if len(v) == 0 {
+			return "", false
+		}
+		return joinKey(v[0])
+	case []string:
+		if len(v) == 0 {
+			return "", false
+		}
+		return joinKey(v[0])
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// loadRecords reads json results, like those of a previous
+// run of humphrey with different rules, from the file at path
+func loadRecords(path string) ([]map[string]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recs []map[string]interface{}
+	dec := json.NewDecoder(f)
+	for {
+		var m map[string]interface{}
+		if err := dec.Decode(&m); err == io.EOF {
+			return recs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		recs = append(recs, m)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// jsonld parses the <script type="application/ld+json"> blocks of the
+// document. If typ is empty it returns the blocks as they are. Otherwise
+// it searches the blocks, including @graph and nested objects, and returns
+// the objects whose @type is typ. The type can be a short name like
+// Product or a full url like https://schema.org/Product.
+// Blocks that are not valid json are ignored.
+func jsonld(doc *goquery.Document, typ string) []interface{} {
+	var vals []interface{}
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(i int, s *goquery.Selection) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s.Text()), &v); err != nil {
+			return
+		}
+		if typ == "" {
+			vals = append(vals, v)
+		} else {
+			vals = appendJSONLDType(vals, v, typ)
+		}
+	})
+
+	return vals
+}
+
+// appendJSONLDType walks v and appends to vals
+// all the objects of type typ. Object members are
+// visited in key order so the result is stable.
+func appendJSONLDType(vals []interface{}, v interface{}, typ string) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, e := range v {
+			vals = appendJSONLDType(vals, e, typ)
+		}
+	case map[string]interface{}:
+		if isJSONLDType(v["@type"], typ) {
+			return append(vals, v)
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			vals = appendJSONLDType(vals, v[k], typ)
+		}
+	}
+	return vals
+}
+
+// isJSONLDType reports whether the @type value t, a string
+// or an array of strings, matches typ
+func isJSONLDType(t interface{}, typ string) bool {
+	switch t := t.(type) {
+	case string:
+		return t == typ || strings.HasSuffix(t, "/"+typ) || strings.HasSuffix(typ, "/"+t)
+	case []interface{}:
+		for _, e := range t {
+			if isJSONLDType(e, typ) {
+				return true
+			}
+		}
+	}
+	return false
+}
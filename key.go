@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cardinality is the expected number of matches of a rule,
+// written after the name like a regexp repetition: {n}, {min,max}
+// or {min,}. Max is negative if there is no upper bound.
+type cardinality struct {
+	Min int
+	Max int
+}
+
+func (c *cardinality) String() string {
+	switch {
+	case c.Min == c.Max:
+		return fmt.Sprintf("{%d}", c.Min)
+	case c.Max < 0:
+		return fmt.Sprintf("{%d,}", c.Min)
+	}
+	return fmt.Sprintf("{%d,%d}", c.Min, c.Max)
+}
+
+// allows reports whether n matches are within the bounds
+func (c *cardinality) allows(n int) bool {
+	return n >= c.Min && (c.Max < 0 || n <= c.Max)
+}
+
+// parseCardinality parses the text between the braces of a cardinality
+func parseCardinality(s string) (*cardinality, error) {
+	lo, hi, isRange := strings.Cut(s, ",")
+	min, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil || min < 0 {
+		return nil, fmt.Errorf("bad cardinality: {%s}", s)
+	}
+	c := &cardinality{min, min}
+	if isRange {
+		if hi = strings.TrimSpace(hi); hi == "" {
+			c.Max = -1
+		} else if c.Max, err = strconv.Atoi(hi); err != nil || c.Max < min {
+			return nil, fmt.Errorf("bad cardinality: {%s}", s)
+		}
+	}
+	return c, nil
+}
+
+// slice selects some of the matches of a rule, written after the
+// name like a python index or slice: [i] or [last] for a single
+// match and [lo:hi] for a range, where lo or hi can be missing.
+// Negative indexes count from the last match. It is applied after
+// the transforms, so that [:10] keeps ten values even after |unique.
+type slice struct {
+	Lo, Hi int
+	Single bool
+	OpenHi bool
+}
+
+// apply returns the selected part of vals
+func (sl *slice) apply(vals []interface{}) []interface{} {
+	n := len(vals)
+	index := func(i int) int {
+		if i < 0 {
+			i += n
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > n {
+			return n
+		}
+		return i
+	}
+
+	if sl.Single {
+		i := sl.Lo
+		if i < 0 {
+			i += n
+		}
+		if i < 0 || i >= n {
+			return nil
+		}
+		return vals[i : i+1]
+	}
+
+	lo, hi := index(sl.Lo), n
+	if !sl.OpenHi {
+		hi = index(sl.Hi)
+	}
+	if lo >= hi {
+		return nil
+	}
+	return vals[lo:hi]
+}
+
+// parseSlice parses the text between the brackets of a slice
+func parseSlice(s string) (*slice, error) {
+	atoi := func(t string, def int) (int, error) {
+		if t = strings.TrimSpace(t); t == "" {
+			return def, nil
+		}
+		return strconv.Atoi(t)
+	}
+
+	lo, hi, isRange := strings.Cut(s, ":")
+	if !isRange {
+		if strings.TrimSpace(lo) == "last" {
+			return &slice{Lo: -1, Single: true}, nil
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("bad index: [%s]", s)
+		}
+		return &slice{Lo: i, Single: true}, nil
+	}
+
+	sl := &slice{OpenHi: strings.TrimSpace(hi) == ""}
+	var err1, err2 error
+	sl.Lo, err1 = atoi(lo, 0)
+	sl.Hi, err2 = atoi(hi, 0)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("bad slice: [%s]", s)
+	}
+	return sl, nil
+}
+
+// keyModifiers are the characters that start a modifier in the key
+const keyModifiers = "{!?[|#"
+
+// parseKey parses the key part of a rule, the name of the result
+// followed by optional modifiers, and sets the corresponding
+// fields of r
+func (r *rule) parseKey(s string) error {
+	i := strings.IndexAny(s, keyModifiers)
+	if i < 0 {
+		i = len(s)
+	}
+	r.Name = s[:i]
+	if r.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+
+	for s = s[i:]; s != ""; {
+		switch s[0] {
+		case '{':
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return fmt.Errorf("unterminated cardinality: %s", s)
+			}
+			c, err := parseCardinality(s[1:end])
+			if err != nil {
+				return err
+			}
+			r.Count = c
+			s = s[end+1:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return fmt.Errorf("unterminated slice: %s", s)
+			}
+			sl, err := parseSlice(s[1:end])
+			if err != nil {
+				return err
+			}
+			r.Slice = sl
+			s = s[end+1:]
+		case '|':
+			s = s[1:]
+			end := strings.IndexAny(s, "("+keyModifiers)
+			if end < 0 {
+				end = len(s)
+			}
+			name, arg := s[:end], ""
+			s = s[end:]
+			if strings.HasPrefix(s, "(") {
+				close := closingParen(s)
+				if close < 0 {
+					return fmt.Errorf("unterminated argument of %s: %s", name, s)
+				}
+				arg, s = s[1:close], s[close+1:]
+			}
+			t, err := newTransform(name, arg)
+			if err != nil {
+				return err
+			}
+			if name == "re" {
+				if _, err := regexp.Compile(arg); err != nil {
+					return fmt.Errorf("bad regular expression of re: %v", err)
+				}
+			}
+			r.Transforms = append(r.Transforms, t)
+		case '!':
+			r.Required = true
+			s = s[1:]
+		case '?':
+			if !strings.HasPrefix(s, "?=") {
+				return fmt.Errorf("expected ?= for default: %s", s)
+			}
+			s = s[2:]
+			var def string
+			if strings.HasPrefix(s, `"`) {
+				q, err := strconv.QuotedPrefix(s)
+				if err != nil {
+					return fmt.Errorf("bad default: %s", s)
+				}
+				def, _ = strconv.Unquote(q)
+				s = s[len(q):]
+			} else {
+				end := strings.IndexAny(s, keyModifiers)
+				if end < 0 {
+					end = len(s)
+				}
+				def, s = s[:end], s[end:]
+			}
+			r.Default = &def
+		case '#':
+			q, err := strconv.QuotedPrefix(s[1:])
+			if err != nil {
+				return fmt.Errorf("expected a quoted description after #: %s", s)
+			}
+			r.Description, _ = strconv.Unquote(q)
+			s = s[1+len(q):]
+		default:
+			return fmt.Errorf("unexpected %q after name", s)
+		}
+	}
+	return nil
+}
+
+// closingParen returns the index of the parenthesis that closes the
+// one at the start of s, or -1. Parentheses can be nested, like in
+// |re(([0-9.]+)), and escaped with a backslash, like in |re(\)).
+func closingParen(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseKeyRegexp(t *testing.T) {
+	for _, tc := range []struct {
+		key, arg string
+	}{
+		{"price|re([0-9.]+)", "[0-9.]+"},
+		{"price|re(([0-9.]+))", "([0-9.]+)"},
+		{"price|re(EUR (\\d+) \\(net\\))|number", "EUR (\\d+) \\(net\\)"},
+		{"price|re((a)(b))[0]", "(a)(b)"},
+	} {
+		r := new(rule)
+		if err := r.parseKey(tc.key); err != nil {
+			t.Errorf("%s: %v", tc.key, err)
+			continue
+		}
+		if len(r.Transforms) == 0 || r.Transforms[0].Arg != tc.arg {
+			t.Errorf("%s: got transforms %v, want re(%s)", tc.key, r.Transforms, tc.arg)
+		}
+	}
+}
+
+func TestParseKeyBadRegexp(t *testing.T) {
+	for _, key := range []string{"price|re([0-9)", "price|re((a)", "price|re(a\\)"} {
+		if err := new(rule).parseKey(key); err == nil {
+			t.Errorf("%s: no error", key)
+		}
+	}
+}
+
+func TestNewRuleRegexpGroup(t *testing.T) {
+	r, err := newRule("price|re(([0-9.]+)):.price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Selector != ".price" || len(r.Transforms) != 1 || r.Transforms[0].Arg != "([0-9.]+)" {
+		t.Errorf("got selector %q and transforms %v", r.Selector, r.Transforms)
+	}
+	v, err := toMatch("only 12.50 EUR", r.Transforms[0].Arg)
+	if err != nil || v != "12.50" {
+		t.Errorf("got %v, %v, want 12.50", v, err)
+	}
+}
+
+func TestNewRuleGrammar(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tr := func(name, arg string) *transform { return &transform{Name: name, Arg: arg} }
+	for _, tc := range []struct {
+		rule string
+		want rule
+	}{
+		{"title:h1", rule{Name: "title", Selector: "h1"}},
+		{"link:a:href", rule{Name: "link", Selector: "a", Attribute: "href"}},
+		{"tags{1,3}:.tag", rule{Name: "tags", Selector: ".tag", Count: &cardinality{1, 3}}},
+		{"tags{2}:.tag", rule{Name: "tags", Selector: ".tag", Count: &cardinality{2, 2}}},
+		{"tags{1,}:.tag", rule{Name: "tags", Selector: ".tag", Count: &cardinality{1, -1}}},
+		{"first[0]:li", rule{Name: "first", Selector: "li", Slice: &slice{Lo: 0, Single: true}}},
+		{"last[last]:li", rule{Name: "last", Selector: "li", Slice: &slice{Lo: -1, Single: true}}},
+		{"some[1:3]:li", rule{Name: "some", Selector: "li", Slice: &slice{Lo: 1, Hi: 3}}},
+		{"rest[2:]:li", rule{Name: "rest", Selector: "li", Slice: &slice{Lo: 2, OpenHi: true}}},
+		{"tail[-2:]:li", rule{Name: "tail", Selector: "li", Slice: &slice{Lo: -2, OpenHi: true}}},
+		{"price|number:.price", rule{Name: "price", Selector: ".price", Transforms: []*transform{tr("number", "")}}},
+		{"when|date(2006-01-02)|squash:time", rule{Name: "when", Selector: "time", Transforms: []*transform{tr("date", "2006-01-02"), tr("squash", "")}}},
+		{"p|money(EUR)[0]:.p", rule{Name: "p", Selector: ".p", Transforms: []*transform{tr("money", "EUR")}, Slice: &slice{Single: true}}},
+		{"title!:h1", rule{Name: "title", Selector: "h1", Required: true}},
+		{`stock?="n/a":.stock`, rule{Name: "stock", Selector: ".stock", Default: str("n/a")}},
+		{`stock?=none:.stock`, rule{Name: "stock", Selector: ".stock", Default: str("none")}},
+		{`stock?="a \"b\"":.stock`, rule{Name: "stock", Selector: ".stock", Default: str(`a "b"`)}},
+		{`price#"the price: net"|number:.price`, rule{Name: "price", Selector: ".price", Description: "the price: net", Transforms: []*transform{tr("number", "")}}},
+		{`p{1,}[0]|number!?="0"#"price":.p`, rule{Name: "p", Selector: ".p", Count: &cardinality{1, -1}, Slice: &slice{Single: true}, Transforms: []*transform{tr("number", "")}, Required: true, Default: str("0"), Description: "price"}},
+		{"title:h1 || h2 || meta[property=\"og:title\"]:content", rule{Name: "title", Selector: "h1",
+			Fallback: &rule{Name: "title", Selector: "h2",
+				Fallback: &rule{Name: "title", Selector: `meta[property="og:title"]`, Attribute: "content"}}}},
+		{"body:article!.ad, script", rule{Name: "body", Selector: "article", Exclude: ".ad, script"}},
+		{`first:"li:first-child"`, rule{Name: "first", Selector: "li:first-child"}},
+		{`alt:"a||b"`, rule{Name: "alt", Selector: "a||b"}},
+		{`id:#a\:b`, rule{Name: "id", Selector: `#a\:b`}},
+		{`id:#a\!b`, rule{Name: "id", Selector: `#a\!b`}},
+		{`x|re(a|b):p`, rule{Name: "x", Selector: "p", Transforms: []*transform{tr("re", "a|b")}}},
+		{`x|re(a\|b):p`, rule{Name: "x", Selector: "p", Transforms: []*transform{tr("re", `a\|b`)}}},
+		{`x|re(\d+:\d+):p`, rule{Name: "x", Selector: "p", Transforms: []*transform{tr("re", `\d+:\d+`)}}},
+		{`x|re(a!b)!:p`, rule{Name: "x", Selector: "p", Transforms: []*transform{tr("re", "a!b")}, Required: true}},
+		{`x|re(\(\d+\)):p`, rule{Name: "x", Selector: "p", Transforms: []*transform{tr("re", `\(\d+\)`)}}},
+	} {
+		r, err := newRule(tc.rule)
+		if err != nil {
+			t.Errorf("%s: %v", tc.rule, err)
+			continue
+		}
+		got, _ := json.Marshal(r)
+		want, _ := json.Marshal(&tc.want)
+		if string(got) != string(want) {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.rule, got, want)
+		}
+	}
+}
+
+func TestNewRuleGrammarErrors(t *testing.T) {
+	for _, s := range []string{
+		"title",
+		":h1",
+		"title:",
+		"title{3,1}:h1",
+		"title{a}:h1",
+		"title{1:h1",
+		"title[x]:h1",
+		"title[1:h1",
+		"title|nosuch:h1",
+		"title|re(a:h1",
+		"title?x:h1",
+		`title?="a:h1`,
+		"title#nodesc:h1",
+		"title:h1 || ",
+	} {
+		if _, err := newRule(s); err == nil {
+			t.Errorf("%s: no error", s)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// locale is the language of the scraped pages, set with -locale.
+// It decides how strings are case folded and compared, for example
+// the dotless i of Turkish or the final sigma of Greek.
+var locale = language.Und
+
+// collator compares strings ignoring case, accents and width
+// according to locale. It is nil unless -fold is set.
+var collator *collate.Collator
+
+func setLocale(tag string, fold bool) error {
+	if tag != "" {
+		t, err := language.Parse(tag)
+		if err != nil {
+			return err
+		}
+		locale = t
+	}
+	if fold {
+		collator = collate.New(locale, collate.IgnoreCase, collate.IgnoreDiacritics, collate.IgnoreWidth)
+	}
+	return nil
+}
+
+// foldString case folds s according to the locale. It lowers first with
+// the rules of the language, so that Turkish I becomes dotless ı, and
+// then folds, so that Greek final sigma ς matches σ.
+func foldString(s string) string {
+	return cases.Fold().String(cases.Lower(locale).String(s))
+}
+
+// compareKey returns the key under which s is grouped or deduplicated.
+// Without -fold it is s itself. With -fold strings that differ only
+// in case, accents or width have the same key.
+func compareKey(s string) string {
+	if collator == nil {
+		return s
+	}
+	var buf collate.Buffer
+	return string(collator.KeyFromString(&buf, s))
+}
+
+// toFold is the |fold transform
+func toFold(s, arg string) (interface{}, error) {
+	return foldString(s), nil
+}
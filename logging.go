@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+var verbose = flag.Bool("v", false, "Log the requests and their http status to stderr")
+
+var veryVerbose = flag.Bool("vv", false, "Log also the number of matches of each rule, for finding why a rule returns nothing")
+
+var logFormat = flag.String("log-format", "text", "the `format` of the log on stderr, text or json for log collectors")
+
+// setupLogging sets the default slog logger by -v, -vv and -log-format.
+// Without -v only warnings and errors are logged.
+func setupLogging() error {
+	level := slog.LevelWarn
+	if *verbose {
+		level = slog.LevelInfo
+	}
+	if *veryVerbose {
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	switch *logFormat {
+	case "text":
+		// the time is noise for people watching a terminal
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		}
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown -log-format: %s", *logFormat)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// debugEnabled tells if debug messages are logged, for
+// skipping the work of preparing them
+func debugEnabled() bool {
+	return slog.Default().Enabled(context.Background(), slog.LevelDebug)
+}
+
+// fatal logs the error v and exits with exitUsage
+func fatal(v ...interface{}) {
+	slog.Error(fmt.Sprint(v...))
+	exit(exitUsage)
+}
+
+// fatalf is like fatal with a format
+func fatalf(format string, v ...interface{}) {
+	slog.Error(fmt.Sprintf(format, v...))
+	exit(exitUsage)
+}
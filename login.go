@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var loginFile = flag.String("login", "", "a json `file` with a login form to submit before scraping, so that the pages behind it can be scraped with its session cookies")
+
+// login is a login form submitted before scraping. The page at URL
+// is downloaded first and each of Tokens is a rule on it, named after
+// a form field, for values like csrf tokens that change on every
+// visit. The Form fields and the tokens are then posted to Post, or
+// URL if empty. Environment variables like $PASSWORD in the Form
+// values are expanded and values like env:PASSWORD are replaced by
+// the variable, so credentials need not be in the file.
+// Check, if set, is a rule that must match on the page after login,
+// like a logout link, otherwise the login failed.
+type login struct {
+	URL    string            `json:"url"`
+	Post   string            `json:"post"`
+	Form   map[string]string `json:"form"`
+	Tokens map[string]string `json:"tokens"`
+	Check  string            `json:"check"`
+
+	tokens []*rule
+	check  *rule
+}
+
+// loadLogin reads the login form from the json file at path
+func loadLogin(path string) (*login, error) {
+	b, err := readOptionFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var l login
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if l.URL == "" {
+		return nil, fmt.Errorf("%s: no url", path)
+	}
+	for field, sel := range l.Tokens {
+		r, err := newRule(field + *ruleSep + sel)
+		if err != nil {
+			return nil, fmt.Errorf("%s: token %s: %v", path, field, err)
+		}
+		l.tokens = append(l.tokens, r)
+	}
+	if l.Check != "" {
+		r, err := newRule(l.Check)
+		if err != nil {
+			return nil, fmt.Errorf("%s: check: %v", path, err)
+		}
+		l.check = r
+	}
+	return &l, nil
+}
+
+// run submits the login form. The session cookies are kept in the
+// cookie jar of client for the requests that follow.
+func (l *login) run() error {
+	if client.Jar == nil {
+		return errors.New("-login needs the session cookies, it can't be used with -no-session")
+	}
+
+	form := make(url.Values)
+	for k, v := range l.Form {
+		if !strings.HasPrefix(v, "env:") {
+			form.Set(k, os.ExpandEnv(v))
+			continue
+		}
+		v, err := secret(v)
+		if err != nil {
+			return fmt.Errorf("-login: form %s: %v", k, err)
+		}
+		form.Set(k, v)
+	}
+	if len(l.tokens) > 0 || l.Post == "" {
+		doc, err := l.page(nil)
+		if err != nil {
+			return err
+		}
+		for _, r := range l.tokens {
+			m := make(map[string]interface{})
+			r.apply(doc, m, false)
+			v, ok := m[r.Name].(string)
+			if !ok {
+				return fmt.Errorf("login: no single value for token %s in %s", r.Name, l.URL)
+			}
+			form.Set(r.Name, v)
+		}
+	}
+
+	post := l.Post
+	if post == "" {
+		post = l.URL
+	}
+	req, err := http.NewRequest("POST", post, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	doc, err := l.page(req)
+	if err != nil {
+		return err
+	}
+	if l.check != nil {
+		m := make(map[string]interface{})
+		l.check.apply(doc, m, false)
+		if isEmpty(m[l.check.Name]) {
+			return fmt.Errorf("login failed: check %s matched nothing after posting to %s", l.check.Name, post)
+		}
+	}
+	slog.Info("logged in", "url", post)
+	return nil
+}
+
+// page fetches req, or the login page if nil, and parses it
+func (l *login) page(req *http.Request) (*goquery.Document, error) {
+	if req == nil {
+		var err error
+		if req, err = http.NewRequest("GET", l.URL, nil); err != nil {
+			return nil, err
+		}
+	}
+	b, _, err := fetch(req, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	defer b.Close()
+	doc, err := goquery.NewDocumentFromReader(b)
+	if err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	doc.Url = b.resp.Request.URL
+	return doc, nil
+}
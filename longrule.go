@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var longRules = multiFlagVar("rule", "a `rule` in long form, like name=price; sel=.price; re=([0-9.]+); type=number, for rules with many options. Can be repeated")
+
+// newLongRule builds a rule from its long form, a list of key=value
+// options separated by semicolons:
+//
+//	name      the name of the result
+//	sel       the css selector or a builtin one like @meta
+//	attr      the attribute, empty for the text
+//	exclude   a css selector of descendants to remove
+//	re        a regular expression, as in |re
+//	type      a transform, like number, bool or date(layout)
+//	default   the result if the rule matches nothing, and of the
+//	          values that can't be converted, as in ?=
+//	limit     the number of values to keep, as in [:n]
+//	count     the expected number of matches, as in {min,max}
+//	required  true, or no value, if a page where the rule matches
+//	          nothing fails
+//	desc      the description of the rule for -schema
+//	unit      the unit of the values for -schema
+//
+// Values can be in quotes, and must be if they have semicolons.
+// Name and sel are required. Unlike the short form, separators
+// in selectors need no escaping.
+func newLongRule(s string) (*rule, error) {
+	r := new(rule)
+	seen := make(map[string]bool)
+	var re, typ string
+	for _, opt := range splitRule(s, ";", -1) {
+		if strings.TrimSpace(opt) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(opt, "=")
+		k, v = strings.TrimSpace(k), unquoteRule(strings.TrimSpace(v))
+		if !ok && k != "required" {
+			return nil, fmt.Errorf("can't parse rule: %s: expected key=value: %s", s, opt)
+		}
+		if seen[k] {
+			return nil, fmt.Errorf("can't parse rule: %s: repeated %s", s, k)
+		}
+		seen[k] = true
+
+		var err error
+		switch k {
+		case "name":
+			r.Name = v
+		case "sel":
+			r.Selector = v
+		case "attr":
+			r.Attribute = v
+		case "exclude":
+			r.Exclude = v
+		case "re":
+			re = v
+			_, err = regexp.Compile(v)
+		case "type":
+			typ = v
+		case "default":
+			r.Default = &v
+		case "limit":
+			var n int
+			if n, err = strconv.Atoi(v); err == nil && n < 0 {
+				err = fmt.Errorf("negative")
+			}
+			r.Slice = &slice{Hi: n}
+		case "count":
+			r.Count, err = parseCardinality(v)
+		case "required":
+			r.Required = true
+			if v != "" {
+				r.Required, err = strconv.ParseBool(v)
+			}
+		case "desc":
+			r.Description = v
+		case "unit":
+			r.Unit = v
+		default:
+			err = fmt.Errorf("unknown option")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't parse rule: %s: %s: %v", s, k, err)
+		}
+	}
+
+	if r.Name == "" {
+		return nil, fmt.Errorf("can't parse rule: %s: missing name", s)
+	}
+	if r.Selector == "" {
+		return nil, fmt.Errorf("can't parse rule: %s: missing selector", s)
+	}
+	if re != "" {
+		t, err := newTransform("re", re)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse rule: %s: %v", s, err)
+		}
+		r.Transforms = append(r.Transforms, t)
+	}
+	if typ != "" {
+		name, arg, _ := strings.Cut(typ, "(")
+		t, err := newTransform(name, strings.TrimSuffix(arg, ")"))
+		if err != nil {
+			return nil, fmt.Errorf("can't parse rule: %s: %v", s, err)
+		}
+		r.Transforms = append(r.Transforms, t)
+	}
+	return r, nil
+}
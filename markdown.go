@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// markdownFormat writes a section per result for pasting into issues
+// and wikis. The url is a heading and single values are a bullet list
+// of the rules. Rules with many values have their own heading with a
+// bullet list, or a table if the values are objects, like those of
+// @table or :{attribute,...}.
+type markdownFormat struct {
+	w     io.Writer
+	rules []*rule
+}
+
+func newMarkdownFormat(w io.Writer, rules []*rule) (formatter, error) {
+	return &markdownFormat{w, rules}, nil
+}
+
+func (f *markdownFormat) write(m map[string]interface{}) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n", markdownLine(fmt.Sprint(m[*key])))
+
+	var lists []string
+	bullets := 0
+	for _, k := range resultKeys(m, f.rules) {
+		if k == *key {
+			continue
+		}
+		switch v := m[k].(type) {
+		case []interface{}:
+			lists = append(lists, k)
+		case map[string]interface{}:
+			lists = append(lists, k)
+		case nil:
+			fmt.Fprintf(&b, "- **%s**: _none_\n", k)
+			bullets++
+		default:
+			fmt.Fprintf(&b, "- **%s**: %s\n", k, markdownBullet(v))
+			bullets++
+		}
+	}
+	if bullets > 0 {
+		b.WriteString("\n")
+	}
+
+	for _, k := range lists {
+		fmt.Fprintf(&b, "### %s\n\n", k)
+		vals, ok := m[k].([]interface{})
+		if !ok {
+			vals = []interface{}{m[k]}
+		}
+		switch {
+		case len(vals) == 0:
+			b.WriteString("_none_\n")
+		case markdownObjects(vals):
+			markdownTable(&b, vals)
+		default:
+			for _, v := range vals {
+				if v != nil {
+					fmt.Fprintf(&b, "- %s\n", markdownBullet(v))
+				}
+			}
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(f.w, b.String())
+	return err
+}
+
+func (f *markdownFormat) close() error {
+	return nil
+}
+
+// markdownObjects tells if all vals are objects, for a table
+func markdownObjects(vals []interface{}) bool {
+	for _, v := range vals {
+		if _, ok := v.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// markdownTable writes the objects vals as a table with a column
+// for each of their members
+func markdownTable(b *strings.Builder, vals []interface{}) {
+	var cols []string
+	for _, v := range vals {
+		var ks []string
+		for k := range v.(map[string]interface{}) {
+			if !contains(cols, k) {
+				ks = append(ks, k)
+			}
+		}
+		sort.Strings(ks)
+		cols = append(cols, ks...)
+	}
+
+	row := func(cells []string) {
+		b.WriteString("|")
+		for _, c := range cells {
+			fmt.Fprintf(b, " %s |", c)
+		}
+		b.WriteString("\n")
+	}
+	var header, sep []string
+	for _, c := range cols {
+		header = append(header, markdownCell(c))
+		sep = append(sep, "---")
+	}
+	row(header)
+	row(sep)
+	for _, v := range vals {
+		var cells []string
+		for _, c := range cols {
+			cells = append(cells, markdownCell(v.(map[string]interface{})[c]))
+		}
+		row(cells)
+	}
+}
+
+// markdownText returns the text of v, objects and arrays as json
+func markdownText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// markdownBullet returns v for a bullet, with the lines
+// of multiline text indented to stay in the bullet
+func markdownBullet(v interface{}) string {
+	return strings.ReplaceAll(strings.TrimSpace(markdownText(v)), "\n", "\n  ")
+}
+
+// markdownCell returns v for a table cell, which can't
+// have pipes or newlines
+func markdownCell(v interface{}) string {
+	s := strings.ReplaceAll(markdownText(v), "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// markdownLine returns s on a single line, for headings
+func markdownLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
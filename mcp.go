@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// mcpProtocolVersion is the version of the Model Context Protocol
+// that the server speaks
+const mcpProtocolVersion = "2024-11-05"
+
+// mcpRequest is a json-rpc 2.0 message received from the client.
+// Notifications have no ID and get no response.
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// mcpResponse is a json-rpc 2.0 response sent to the client
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpExtractTool describes the only tool exposed by the server.
+// It downloads a url and applies the rules, exactly like
+// the command line does for a single page.
+var mcpExtractTool = map[string]interface{}{
+	"name":        "extract",
+	"description": "Download an html page and extract structured data from it. Each rule has the form key:selector[:attribute] where selector is a css selector. The result is a json object with one entry per rule key.",
+	"inputSchema": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "the url of the page",
+			},
+			"rules": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "the extraction rules, key:selector[:attribute]",
+			},
+		},
+		"required": []string{"url", "rules"},
+	},
+}
+
+// serveMCP runs a Model Context Protocol server on r and w
+// using newline delimited json-rpc messages. It returns
+// when r is exhausted or a message can't be written.
+func serveMCP(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	for scanner.Scan() {
+		var req mcpRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp := mcpResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+				Error: &mcpError{-32700, "parse error"}}
+			if err := enc.Encode(resp); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.ID == nil {
+			continue
+		}
+
+		resp := mcpResponse{JSONRPC: "2.0", ID: req.ID}
+		switch req.Method {
+		case "initialize":
+			resp.Result = map[string]interface{}{
+				"protocolVersion": mcpProtocolVersion,
+				"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+				"serverInfo":      map[string]interface{}{"name": "humphrey", "version": "1.0.0"},
+			}
+		case "ping":
+			resp.Result = map[string]interface{}{}
+		case "tools/list":
+			resp.Result = map[string]interface{}{
+				"tools": []interface{}{mcpExtractTool},
+			}
+		case "tools/call":
+			result, err := mcpCallTool(req.Params)
+			if err != nil {
+				resp.Error = &mcpError{-32602, err.Error()}
+			} else {
+				resp.Result = result
+			}
+		default:
+			resp.Error = &mcpError{-32601, "method not found: " + req.Method}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// mcpCallTool executes a tools/call request. Protocol errors, like
+// an unknown tool, are returned as error. Failures of the extraction
+// are reported to the client as a tool result with isError set.
+func mcpCallTool(params json.RawMessage) (interface{}, error) {
+	var call struct {
+		Name      string `json:"name"`
+		Arguments struct {
+			URL   string   `json:"url"`
+			Rules []string `json:"rules"`
+		} `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, err
+	}
+	if call.Name != "extract" {
+		return nil, fmt.Errorf("unknown tool: %s", call.Name)
+	}
+
+	text, err := mcpExtract(call.Arguments.URL, call.Arguments.Rules)
+	if err != nil {
+		return map[string]interface{}{
+			"content": []interface{}{map[string]interface{}{"type": "text", "text": err.Error()}},
+			"isError": true,
+		}, nil
+	}
+	return map[string]interface{}{
+		"content": []interface{}{map[string]interface{}{"type": "text", "text": text}},
+	}, nil
+}
+
+// mcpExtract applies the rules to the page of url u
+// and returns the result map encoded as json
+func mcpExtract(u string, ss []string) (string, error) {
+	if u == "" {
+		return "", fmt.Errorf("missing url")
+	}
+	if len(ss) == 0 {
+		return "", fmt.Errorf("missing rules")
+	}
+
+	var rules []*rule
+	for _, s := range ss {
+		r, err := newRule(s)
+		if err != nil {
+			return "", err
+		}
+		rules = append(rules, r)
+	}
+
+	m, err := downloadAndApplyRules(u, rules, *arrays, nil)
+	if err != nil {
+		return "", err
+	}
+	m[*key] = u
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(m); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
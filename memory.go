@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"runtime/debug"
+	runtimemetrics "runtime/metrics"
+)
+
+var maxMemory = byteSizeVar("max-memory", 0, "Limit the memory of humphrey to `size`, like 2GB, by setting GOMEMLIMIT, and fail the urls whose pages would exceed it instead of all of them. 0 for the GOMEMLIMIT of the environment, if any")
+
+// errMaxMemory is the error of the pages too large to parse in the
+// memory left
+var errMaxMemory = errors.New("not enough memory under -max-memory")
+
+// memoryLimit is the limit of the memory in bytes, 0 if none
+var memoryLimit int64
+
+// domFactor is about how many times larger than its html a page
+// is when parsed
+const domFactor = 10
+
+// setupMemoryLimit sets the memory limit of the runtime to -max-memory
+// or, if it is not set, takes the one of GOMEMLIMIT
+func setupMemoryLimit() {
+	if *maxMemory > 0 {
+		debug.SetMemoryLimit(int64(*maxMemory))
+	}
+	if l := debug.SetMemoryLimit(-1); l != math.MaxInt64 {
+		memoryLimit = l
+	}
+}
+
+// heapBytes returns the bytes of the heap taken by objects, live or not
+// yet collected
+func heapBytes() int64 {
+	s := []runtimemetrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	runtimemetrics.Read(s)
+	return int64(s[0].Value.Uint64())
+}
+
+// overMemory reports whether the heap is near the memory limit, after
+// a collection if it looks so, leaving room for the rest of the run
+func overMemory(need int64) bool {
+	high := memoryLimit / 10 * 9
+	if heapBytes()+need < high {
+		return false
+	}
+	runtime.GC()
+	return heapBytes()+need >= high
+}
+
+// checkMemory returns an error if the page of url u, with a body of
+// size bytes, is too large to parse in the memory left. Pages of
+// unknown size are checked as they are parsed by guardMemory.
+func checkMemory(u string, size int64) error {
+	if memoryLimit == 0 || size <= 0 {
+		return nil
+	}
+	if overMemory(size * domFactor) {
+		return fmt.Errorf("%w to parse %d bytes for url: %s", errMaxMemory, size, u)
+	}
+	return nil
+}
+
+// memoryGuard is a reader that fails when the heap gets near the
+// memory limit, so that parsing a page too large fails the url
+// instead of all of them
+type memoryGuard struct {
+	r    io.Reader
+	u    string
+	read int64
+}
+
+// memoryCheckBytes is how often, in bytes read, memoryGuard checks
+const memoryCheckBytes = 1 << 20
+
+// guardMemory returns r guarded with -max-memory, if there is a limit
+func guardMemory(r io.Reader, u string) io.Reader {
+	if memoryLimit == 0 {
+		return r
+	}
+	return &memoryGuard{r: r, u: u}
+}
+
+func (g *memoryGuard) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	g.read += int64(n)
+	if g.read >= memoryCheckBytes {
+		g.read = 0
+		if overMemory(0) {
+			return n, fmt.Errorf("%w to parse the page of url: %s", errMaxMemory, g.u)
+		}
+	}
+	return n, err
+}
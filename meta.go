@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// meta returns the content of the <meta> elements whose property
+// or name is prop, for example og:title or description. OpenGraph uses
+// the property attribute while Twitter Cards and plain html use name,
+// so both are checked. If prop ends with * it is a prefix and the result
+// is a single object that maps each matching property to its content,
+// for example og:* returns all the OpenGraph properties of the page.
+// Properties that appear more than once, like og:image, map to arrays.
+func meta(doc *goquery.Document, prop string) []interface{} {
+	var vals []interface{}
+
+	prefix := strings.HasSuffix(prop, "*")
+	obj := make(map[string]interface{})
+	doc.Find("meta[content]").Each(func(i int, s *goquery.Selection) {
+		name, exists := s.Attr("property")
+		if !exists {
+			name, exists = s.Attr("name")
+		}
+		if !exists {
+			return
+		}
+		content, _ := s.Attr("content")
+		content = strings.TrimSpace(content)
+
+		if !prefix {
+			if strings.EqualFold(name, prop) {
+				vals = append(vals, content)
+			}
+			return
+		}
+		if !strings.HasPrefix(strings.ToLower(name), strings.ToLower(strings.TrimSuffix(prop, "*"))) {
+			return
+		}
+		switch v := obj[name].(type) {
+		case nil:
+			obj[name] = content
+		case string:
+			obj[name] = []interface{}{v, content}
+		case []interface{}:
+			obj[name] = append(v, content)
+		}
+	})
+
+	if prefix && len(obj) > 0 {
+		vals = append(vals, obj)
+	}
+	return vals
+}
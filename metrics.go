@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var metricsAddr = flag.String("metrics", "", "Serve the metrics of the run for Prometheus at http://`address`/metrics, like :9090, and the pprof profiles at /debug/pprof/")
+
+// runMetrics are the metrics of -metrics, nil if disabled
+var runMetrics *metrics
+
+// errSoft404 is the error of the pages found to be soft 404s
+var errSoft404 = errors.New("soft 404")
+
+// latencyBuckets are the upper bounds, in seconds, of the
+// buckets of the histogram of the fetch latencies
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metrics are the counters of a run, exposed in the text format of
+// Prometheus so that long running scrapes of stdin can be monitored
+// like any other service. Unlike -quality, they are live.
+type metrics struct {
+	mu      sync.Mutex
+	fetched map[int]int64
+	errors  map[string]int64
+	matched map[string]int64
+	empty   map[string]int64
+	// latency is the histogram of the fetches, one count per bucket
+	// and a last one for the slower ones
+	latency    []int64
+	latencySum float64
+}
+
+// serveMetrics starts the server of the metrics at addr
+func serveMetrics(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	runMetrics = &metrics{
+		fetched: make(map[int]int64),
+		errors:  make(map[string]int64),
+		matched: make(map[string]int64),
+		empty:   make(map[string]int64),
+		latency: make([]int64, len(latencyBuckets)+1),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		runMetrics.write(w)
+	})
+	// live profiles of long runs, see -cpuprofile and -memprofile
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			slog.Error("metrics server", "error", err)
+		}
+	}()
+	return nil
+}
+
+// fetch records a response with status that took d
+func (m *metrics) fetch(status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetched[status]++
+	s := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, s)
+	m.latency[i]++
+	m.latencySum += s
+}
+
+// rule records that rule matched n elements on a page
+func (m *metrics) rule(rule string, n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.matched[rule] += int64(n)
+	if n == 0 {
+		m.empty[rule]++
+	}
+}
+
+// fail records err, the error of a url
+func (m *metrics) fail(err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors[errorType(err)]++
+}
+
+// errorType returns the kind of err for the metrics
+func errorType(err error) string {
+	var ne net.Error
+	var fe *fetchError
+	var re *requiredError
+	var ce *countError
+	switch {
+	case errors.As(err, &ne) && ne.Timeout():
+		return "timeout"
+	case errors.As(err, &fe):
+		return "fetch"
+	case errors.Is(err, errSoft404):
+		return "soft404"
+	case errors.Is(err, errMaxMemory):
+		return "memory"
+	case errors.As(err, &re):
+		return "required"
+	case errors.As(err, &ce):
+		return "count"
+	}
+	return "other"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// write writes the metrics in the text exposition format
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP humphrey_pages_fetched_total Responses received, by http status.")
+	fmt.Fprintln(w, "# TYPE humphrey_pages_fetched_total counter")
+	statuses := make([]int, 0, len(m.fetched))
+	for s := range m.fetched {
+		statuses = append(statuses, s)
+	}
+	sort.Ints(statuses)
+	for _, s := range statuses {
+		fmt.Fprintf(w, "humphrey_pages_fetched_total{status=\"%d\"} %d\n", s, m.fetched[s])
+	}
+
+	fmt.Fprintln(w, "# HELP humphrey_bytes_downloaded_total Bytes of the bodies read.")
+	fmt.Fprintln(w, "# TYPE humphrey_bytes_downloaded_total counter")
+	fmt.Fprintf(w, "humphrey_bytes_downloaded_total %d\n", downloaded.Load())
+
+	fmt.Fprintln(w, "# HELP humphrey_errors_total Urls failed, by kind of error.")
+	fmt.Fprintln(w, "# TYPE humphrey_errors_total counter")
+	writeLabeled(w, "humphrey_errors_total", "type", m.errors)
+
+	fmt.Fprintln(w, "# HELP humphrey_rule_matches_total Elements matched, by rule.")
+	fmt.Fprintln(w, "# TYPE humphrey_rule_matches_total counter")
+	writeLabeled(w, "humphrey_rule_matches_total", "rule", m.matched)
+
+	fmt.Fprintln(w, "# HELP humphrey_rule_empty_total Pages where a rule matched nothing, by rule.")
+	fmt.Fprintln(w, "# TYPE humphrey_rule_empty_total counter")
+	writeLabeled(w, "humphrey_rule_empty_total", "rule", m.empty)
+
+	fmt.Fprintln(w, "# HELP humphrey_fetch_duration_seconds Time from the request to the end of the body.")
+	fmt.Fprintln(w, "# TYPE humphrey_fetch_duration_seconds histogram")
+	var n int64
+	for i, le := range latencyBuckets {
+		n += m.latency[i]
+		fmt.Fprintf(w, "humphrey_fetch_duration_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(le, 'g', -1, 64), n)
+	}
+	n += m.latency[len(latencyBuckets)]
+	fmt.Fprintf(w, "humphrey_fetch_duration_seconds_bucket{le=\"+Inf\"} %d\n", n)
+	fmt.Fprintf(w, "humphrey_fetch_duration_seconds_sum %s\n", strconv.FormatFloat(m.latencySum, 'g', -1, 64))
+	fmt.Fprintf(w, "humphrey_fetch_duration_seconds_count %d\n", n)
+}
+
+// writeLabeled writes the samples of counts, one per value of label
+func writeLabeled(w io.Writer, name, label string, counts map[string]int64) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, labelEscaper.Replace(k), counts[k])
+	}
+}
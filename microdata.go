@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// microdata returns the schema.org microdata items of the document
+// as nested objects that mirror the itemscope/itemprop tree. Each
+// object has an @type with the itemtype and one member per itemprop.
+// If typ is empty it returns the top level items, those that are not
+// a property of another item. Otherwise it returns all the items,
+// at any depth, whose itemtype is typ. Like @jsonld, typ can be
+// a short name like Person or a full url.
+func microdata(doc *goquery.Document, typ string) []interface{} {
+	var vals []interface{}
+
+	doc.Find("[itemscope]").Each(func(i int, s *goquery.Selection) {
+		if typ == "" {
+			if _, isProp := s.Attr("itemprop"); !isProp {
+				vals = append(vals, microdataItem(s))
+			}
+			return
+		}
+		itemtype, _ := s.Attr("itemtype")
+		for _, t := range strings.Fields(itemtype) {
+			if isJSONLDType(t, typ) {
+				vals = append(vals, microdataItem(s))
+				return
+			}
+		}
+	})
+
+	return vals
+}
+
+// microdataItem builds the object for the item with scope s
+func microdataItem(s *goquery.Selection) map[string]interface{} {
+	item := make(map[string]interface{})
+	if itemtype, exists := s.Attr("itemtype"); exists {
+		item["@type"] = itemtype
+	}
+	s.Children().Each(func(i int, c *goquery.Selection) {
+		microdataProps(c, item)
+	})
+	return item
+}
+
+// microdataProps adds to item the properties found in s and its
+// descendants. It does not descend into nested items because
+// their properties belong to them.
+func microdataProps(s *goquery.Selection, item map[string]interface{}) {
+	_, isScope := s.Attr("itemscope")
+	if names, isProp := s.Attr("itemprop"); isProp {
+		var v interface{}
+		if isScope {
+			v = microdataItem(s)
+		} else {
+			v = microdataValue(s)
+		}
+		for _, name := range strings.Fields(names) {
+			switch old := item[name].(type) {
+			case nil:
+				item[name] = v
+			case []interface{}:
+				item[name] = append(old, v)
+			default:
+				item[name] = []interface{}{old, v}
+			}
+		}
+	}
+	if isScope {
+		return
+	}
+	s.Children().Each(func(i int, c *goquery.Selection) {
+		microdataProps(c, item)
+	})
+}
+
+// microdataValue returns the value of a property element
+// according to the rules of the html microdata specification
+func microdataValue(s *goquery.Selection) string {
+	var attr string
+	switch goquery.NodeName(s) {
+	case "meta":
+		attr = "content"
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		attr = "src"
+	case "a", "area", "link":
+		attr = "href"
+	case "object":
+		attr = "data"
+	case "data", "meter":
+		attr = "value"
+	case "time":
+		attr = "datetime"
+	}
+	if attr != "" {
+		if v, exists := s.Attr(attr); exists {
+			return strings.TrimSpace(v)
+		}
+	}
+	return strings.TrimSpace(s.Text())
+}
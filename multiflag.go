@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+// multiFlag is a flag.Value for flags that can be repeated.
+// Each occurrence appends its value.
+type multiFlag []string
+
+func (f *multiFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *multiFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// multiFlagVar defines a repeatable flag with the given name and usage
+func multiFlagVar(name, usage string) *multiFlag {
+	f := new(multiFlag)
+	flag.Var(f, name, usage)
+	return f
+}
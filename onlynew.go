@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var onlyNewFile = flag.String("only-new", "", "Skip the urls unchanged since the previous run, by their ETag, Last-Modified, content or sitemap lastmod, kept in the state `file`")
+
+// errUnchanged is returned with -only-new for pages that have
+// not changed since the previous run. They are skipped silently.
+var errUnchanged = errors.New("unchanged since the previous run")
+
+// onlyNew is the state of -only-new, nil if disabled
+var onlyNew *seenState
+
+// seenState remembers the pages scraped by previous runs, so that
+// nightly runs over large sites scrape only the new and changed ones.
+// Pages are revalidated with conditional requests, then by the hash
+// of their body, and urls of -sitemap are not even requested if their
+// lastmod is the one of the previous run. Only the pages scraped
+// successfully are remembered, failed urls are tried again next time.
+type seenState struct {
+	path  string
+	mu    sync.Mutex
+	pages map[string]*seenPage
+	// lastmods are the lastmods of the urls of -sitemap in this run
+	lastmods map[string]string
+}
+
+// seenPage is a page scraped by a run with its validators
+type seenPage struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	BodyHash     string    `json:"body_sha256"`
+	LastMod      string    `json:"sitemap_lastmod,omitempty"`
+	Scraped      time.Time `json:"scraped"`
+}
+
+// loadSeenState reads the state at path. A missing file is an empty
+// state, for the first run. The state is written when humphrey exits.
+func loadSeenState(path string) (*seenState, error) {
+	s := &seenState{path: path, pages: make(map[string]*seenPage)}
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &s.pages); err != nil {
+			return nil, err
+		}
+	}
+	atExit = append(atExit, func() {
+		if err := s.save(); err != nil {
+			slog.Error("can't write -only-new", "error", err)
+		}
+	})
+	return s, nil
+}
+
+// conditional returns the headers that make the request for u
+// conditional on the page of the previous run, or nil
+func (s *seenState) conditional(u string) http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.pages[u]
+	if p == nil {
+		return nil
+	}
+	return (&cacheEntry{ETag: p.ETag, LastModified: p.LastModified}).conditional()
+}
+
+// unchanged reports whether the page of u is the one of the previous
+// run, by its sitemap lastmod if hash is empty or else by hash
+func (s *seenState) unchanged(u, hash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.pages[u]
+	if p == nil {
+		return false
+	}
+	if hash == "" {
+		lm := s.lastmods[u]
+		return lm != "" && lm == p.LastMod
+	}
+	return p.BodyHash == hash
+}
+
+// add remembers the page of u, scraped with the response headers hdr
+func (s *seenState) add(u, hash string, hdr http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[u] = &seenPage{
+		ETag:         hdr.Get("ETag"),
+		LastModified: hdr.Get("Last-Modified"),
+		BodyHash:     hash,
+		LastMod:      s.lastmods[u],
+		Scraped:      time.Now().UTC(),
+	}
+}
+
+// save writes the state to a temporary file first, so that a
+// crash never leaves half a state
+func (s *seenState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := json.Marshal(s.pages)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var otelEndpoint = flag.String("otel-endpoint", "", "Export traces of the download, parsing and rules of every url with OTLP over http to `url`, like http://localhost:4318")
+
+// tracer traces the scraping of the urls. Its spans go nowhere
+// unless -otel-endpoint is set. A url is a scrape span with a
+// download span, until the response headers, a parse span, that
+// also reads the body as pages are parsed as they download, and
+// a rules span.
+var tracer = otel.Tracer("github.com/anastasop/humphrey")
+
+// startTracing exports the spans of tracer to the OTLP collector at
+// endpoint. The spans not yet exported are flushed when humphrey exits.
+func startTracing(endpoint string) error {
+	exp, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", "humphrey")))
+	if err != nil {
+		return err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	atExit = append(atExit, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		tp.Shutdown(ctx)
+	})
+	return nil
+}
+
+// endSpan ends span with the error of its step. Pages skipped
+// because they are duplicate or unchanged are not errors.
+func endSpan(span trace.Span, err error) {
+	switch err {
+	case nil, errNotModified:
+	case errDuplicate, errUnchanged:
+		span.SetAttributes(attribute.String("humphrey.skipped", err.Error()))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
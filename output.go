@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// outputFile is the file of -o. Unless it is appended to, results are
+// written to a temporary file in the same directory that replaces the
+// file when the run finishes, so that a killed run never leaves a
+// truncated file behind. Failed runs leave the file as it was and
+// the temporary file for inspection. When appending, each json result is written
+// with a single write at the end of the file.
+type outputFile struct {
+	*os.File
+	path string
+	tmp  bool
+}
+
+func openOutput(path string, appendMode bool) (*outputFile, error) {
+	if appendMode {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &outputFile{f, path, false}, nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{f, path, true}, nil
+}
+
+// commit closes the file and, if it is temporary, renames it to path
+func (o *outputFile) commit() error {
+	if !o.tmp {
+		return o.Close()
+	}
+	if err := o.Sync(); err != nil {
+		return err
+	}
+	if err := o.Chmod(0644); err != nil {
+		return err
+	}
+	if err := o.Close(); err != nil {
+		return err
+	}
+	return os.Rename(o.Name(), o.path)
+}
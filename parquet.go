@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// parquetFormat writes the results as a parquet file for analytics
+// tools like DuckDB or Spark. Each url is a row with a column for the
+// url key and one for each rule, typed by its last converting
+// transform: double for |number, boolean for |bool, timestamp for
+// |date and string otherwise. Objects, like those of |money, are json
+// strings. Columns are lists unless the rule keeps a single match
+// with [i]. Rows are kept in memory and written as a single row group
+// of uncompressed pages on close.
+type parquetFormat struct {
+	w    io.Writer
+	cols []*parquetColumn
+	rows int
+}
+
+// parquetColumn collects the values and the levels of a column.
+// Repetition levels are kept only for lists and definition
+// levels for all but the required url key.
+type parquetColumn struct {
+	name     string
+	typ      string
+	list     bool
+	required bool
+
+	values []interface{}
+	reps   []int
+	defs   []int
+}
+
+// parquet physical, repetition and converted types and encodings
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+	parquetRepeated = 2
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+func newParquetFormat(w io.Writer, rules []*rule) (formatter, error) {
+	if len(rules) == 0 {
+		return nil, errors.New("parquet needs the rules of the command line for its columns")
+	}
+	cols := []*parquetColumn{{name: *key, typ: "string", required: true}}
+	for _, r := range rules {
+		list := r.Slice == nil || !r.Slice.Single || *arrays
+		cols = append(cols, &parquetColumn{name: r.Name, typ: parquetType(r), list: list})
+	}
+	return &parquetFormat{w: w, cols: cols}, nil
+}
+
+// parquetType returns the type of the values of the rule
+func parquetType(r *rule) string {
+	for i := len(r.Transforms) - 1; i >= 0; i-- {
+		switch t := r.Transforms[i].Name; t {
+		case "number", "bool", "date":
+			return t
+		case "money":
+			return "string"
+		}
+	}
+	return "string"
+}
+
+func (f *parquetFormat) write(m map[string]interface{}) error {
+	f.rows++
+	for _, c := range f.cols {
+		var vals []interface{}
+		switch v := m[c.name].(type) {
+		case nil:
+		case []interface{}:
+			vals = v
+		default:
+			vals = []interface{}{v}
+		}
+
+		switch {
+		case c.required:
+			var v interface{} = ""
+			if len(vals) > 0 {
+				v = parquetValue(vals[0], c.typ)
+			}
+			c.values = append(c.values, v)
+		case c.list:
+			// lists of primitives can't have nulls, so values
+			// that can't be converted are left out
+			rep := 0
+			for _, v := range vals {
+				if v = parquetValue(v, c.typ); v != nil {
+					c.add(rep, v)
+					rep = 1
+				}
+			}
+			if rep == 0 {
+				c.add(0, nil)
+			}
+		default:
+			var v interface{}
+			if len(vals) > 0 {
+				v = parquetValue(vals[0], c.typ)
+			}
+			c.add(0, v)
+		}
+	}
+	return nil
+}
+
+// add adds a value of an optional column, or a null if v is nil,
+// with repetition level rep if the column is a list. The null of a
+// list is the empty list.
+func (c *parquetColumn) add(rep int, v interface{}) {
+	if c.list {
+		c.reps = append(c.reps, rep)
+	}
+	if v == nil {
+		c.defs = append(c.defs, 0)
+		return
+	}
+	c.defs = append(c.defs, 1)
+	c.values = append(c.values, v)
+}
+
+// parquetValue converts v to the value of a column of type typ,
+// nil if it can't
+func parquetValue(v interface{}, typ string) interface{} {
+	switch typ {
+	case "number":
+		if _, ok := v.(float64); ok {
+			return v
+		}
+		return nil
+	case "bool":
+		if _, ok := v.(bool); ok {
+			return v
+		}
+		return nil
+	case "date":
+		if s, ok := v.(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				return t.UnixMilli()
+			}
+		}
+		return nil
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// close writes the file: the magic, a data page for each column and
+// the footer with the schema and the offsets of the pages
+func (f *parquetFormat) close() error {
+	var out bytes.Buffer
+	out.WriteString("PAR1")
+
+	var chunks []func(t *thrift)
+	var total int64
+	for _, c := range f.cols {
+		ptype, _ := c.types()
+		offset := int64(out.Len())
+		page := c.page()
+
+		var h thrift
+		h.i32(1, 0) // DATA_PAGE
+		h.i32(2, int32(len(page)))
+		h.i32(3, int32(len(page)))
+		h.begin(5)
+		h.i32(1, int32(c.count()))
+		h.i32(2, parquetPlain)
+		h.i32(3, parquetRLE)
+		h.i32(4, parquetRLE)
+		h.end()
+		h.stop()
+
+		out.Write(h.b)
+		out.Write(page)
+		size := int64(len(h.b) + len(page))
+		total += size
+
+		name, count := c.name, c.count()
+		chunks = append(chunks, func(t *thrift) {
+			t.i64(2, offset)
+			t.begin(3)
+			t.i32(1, ptype)
+			t.list(2, thriftI32, 2)
+			t.varint(zigzag(parquetPlain))
+			t.varint(zigzag(parquetRLE))
+			t.list(3, thriftBinary, 1)
+			t.str(name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, int64(count))
+			t.i64(6, size)
+			t.i64(7, size)
+			t.i64(9, offset)
+			t.end()
+		})
+	}
+
+	var t thrift
+	t.i32(1, 1)
+	t.list(2, thriftStruct, len(f.cols)+1)
+	t.elem()
+	t.string(4, "schema")
+	t.i32(5, int32(len(f.cols)))
+	t.end()
+	for _, c := range f.cols {
+		ptype, conv := c.types()
+		rep := int32(parquetOptional)
+		switch {
+		case c.required:
+			rep = parquetRequired
+		case c.list:
+			rep = parquetRepeated
+		}
+		t.elem()
+		t.i32(1, ptype)
+		t.i32(3, rep)
+		t.string(4, c.name)
+		if conv >= 0 {
+			t.i32(6, conv)
+		}
+		t.end()
+	}
+	t.i64(3, int64(f.rows))
+	t.list(4, thriftStruct, 1)
+	t.elem()
+	t.list(1, thriftStruct, len(chunks))
+	for _, chunk := range chunks {
+		t.elem()
+		chunk(&t)
+		t.end()
+	}
+	t.i64(2, total)
+	t.i64(3, int64(f.rows))
+	t.end()
+	t.string(6, "humphrey")
+	t.stop()
+
+	out.Write(t.b)
+	binary.Write(&out, binary.LittleEndian, uint32(len(t.b)))
+	out.WriteString("PAR1")
+	_, err := f.w.Write(out.Bytes())
+	return err
+}
+
+// types returns the physical and the converted type of the column,
+// -1 if it has none
+func (c *parquetColumn) types() (int32, int32) {
+	switch c.typ {
+	case "number":
+		return parquetDouble, -1
+	case "bool":
+		return parquetBoolean, -1
+	case "date":
+		return parquetInt64, parquetTimestampMillis
+	}
+	return parquetByteArray, parquetUTF8
+}
+
+// count returns the number of values of the column, including nulls
+func (c *parquetColumn) count() int {
+	if c.required {
+		return len(c.values)
+	}
+	return len(c.defs)
+}
+
+// page returns the data of the page of the column: the repetition
+// and definition levels, if any, and the plain encoded values
+func (c *parquetColumn) page() []byte {
+	var b bytes.Buffer
+	if c.list {
+		levels(&b, c.reps)
+	}
+	if !c.required {
+		levels(&b, c.defs)
+	}
+	var bits byte
+	for i, v := range c.values {
+		switch v := v.(type) {
+		case bool:
+			if v {
+				bits |= 1 << (i % 8)
+			}
+			if i%8 == 7 || i == len(c.values)-1 {
+				b.WriteByte(bits)
+				bits = 0
+			}
+		case float64:
+			binary.Write(&b, binary.LittleEndian, math.Float64bits(v))
+		case int64:
+			binary.Write(&b, binary.LittleEndian, v)
+		case string:
+			binary.Write(&b, binary.LittleEndian, uint32(len(v)))
+			b.WriteString(v)
+		}
+	}
+	return b.Bytes()
+}
+
+// levels writes the levels, which are 0 or 1, with the RLE
+// encoding of bit width 1 prefixed by their length
+func levels(b *bytes.Buffer, ls []int) {
+	var t thrift
+	for i := 0; i < len(ls); {
+		j := i
+		for j < len(ls) && ls[j] == ls[i] {
+			j++
+		}
+		t.varint(uint64(j-i) << 1)
+		t.b = append(t.b, byte(ls[i]))
+		i = j
+	}
+	binary.Write(b, binary.LittleEndian, uint32(len(t.b)))
+	b.Write(t.b)
+}
+
+// thrift types of the compact protocol
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thrift encodes the structures of the parquet footer with the
+// thrift compact protocol. Fields are written in the order of
+// their ids, which are delta encoded from the previous field of
+// the struct, and structs are closed with end.
+type thrift struct {
+	b     []byte
+	last  int16
+	stack []int16
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	if d := id - t.last; d > 0 && d <= 15 {
+		t.b = append(t.b, byte(d)<<4|typ)
+	} else {
+		t.b = append(t.b, typ)
+		t.varint(zigzag(int64(id)))
+	}
+	t.last = id
+}
+
+func (t *thrift) varint(v uint64) {
+	t.b = binary.AppendUvarint(t.b, v)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1 ^ v>>63)
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thrift) string(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.str(s)
+}
+
+// str writes s without a field header, as an element of a list
+func (t *thrift) str(s string) {
+	t.varint(uint64(len(s)))
+	t.b = append(t.b, s...)
+}
+
+// list starts a list of n elements of type typ
+func (t *thrift) list(id int16, typ byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.b = append(t.b, byte(n)<<4|typ)
+	} else {
+		t.b = append(t.b, 0xf0|typ)
+		t.varint(uint64(n))
+	}
+}
+
+// begin starts a struct field and elem a struct element of a list
+func (t *thrift) begin(id int16) {
+	t.field(id, thriftStruct)
+	t.elem()
+}
+
+func (t *thrift) elem() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+func (t *thrift) end() {
+	t.stop()
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thrift) stop() {
+	t.b = append(t.b, 0)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// TestParquetGolden checks a file of a single row, a required key
+// and an optional double, against bytes written by hand from the
+// parquet format and the thrift compact protocol
+func TestParquetGolden(t *testing.T) {
+	r, err := newRule("n|number[0]:.n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	f, err := newParquetFormat(&buf, []*rule{r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.write(map[string]interface{}{"key": "u", "n": 12.5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := []string{
+		"50415231", // PAR1
+
+		// page header of key at 4: DATA_PAGE, 5 bytes, 1 value, PLAIN, RLE, RLE
+		"1500 150a 150a 2c 1502 1500 1506 1506 00 00",
+		"01000000 75", // "u"
+
+		// page header of n at 26: 14 bytes
+		"1500 151c 151c 2c 1502 1500 1506 1506 00 00",
+		"02000000 0201",    // definition levels: a run of one 1
+		"0000000000002940", // 12.5
+
+		// footer: version 1
+		"1502",
+		// schema: root with 2 children, key required UTF8, n optional double
+		"193c",
+		"48 06 736368656d61 1504 00",
+		"150c 2500 18 03 6b6579 2500 00",
+		"150a 2502 18 01 6e 00",
+		// num_rows 1
+		"1602",
+		// a row group of 2 column chunks
+		"191c",
+		"192c",
+		// key: offset 4, BYTE_ARRAY, PLAIN and RLE, path key, 1 value, 22 bytes
+		"2608 1c 150c 1925 00 06 1918 03 6b6579 1500 1602 162c 162c 2608 00 00",
+		// n: offset 26, DOUBLE, PLAIN and RLE, path n, 1 value, 31 bytes
+		"2634 1c 150a 1925 00 06 1918 01 6e 1500 1602 163e 163e 2634 00 00",
+		// total size 53 and 1 row
+		"166a 1602 00",
+		// created by humphrey
+		"28 08 68756d7068726579",
+		"00",
+	}
+	want, err := hex.DecodeString(strings.ReplaceAll(strings.Join(golden, ""), " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	footer := len(want) - len("PAR1") - 22 - 31
+	want = append(want, byte(footer), 0, 0, 0)
+	want = append(want, "PAR1"...)
+
+	if got := buf.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", hex.Dump(got), hex.Dump(want))
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+)
+
+// stage is a step of a pipeline. It scrapes its urls with its rules
+// and writes the results to Output, a file or - for stdout. The values
+// of the Follow rule, usually links, are the urls of the next stage.
+// The first stage starts from its URLs or, if it has none, from the
+// urls of the command line.
+type stage struct {
+	Name   string   `json:"name"`
+	URLs   []string `json:"urls"`
+	Rules  []string `json:"rules"`
+	Follow string   `json:"follow"`
+	Output string   `json:"output"`
+
+	rules []*rule
+}
+
+// pipeline is a declarative multi-hop scrape, for example
+// from categories to listings to product details
+type pipeline struct {
+	Stages []*stage `json:"stages"`
+}
+
+// loadPipeline reads a pipeline from the json file at path.
+// All stages but the last must have a Follow rule. If no stage
+// has an Output, the last one writes to stdout.
+func loadPipeline(path string) (*pipeline, error) {
+	b, err := readOptionFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p pipeline
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(p.Stages) == 0 {
+		return nil, fmt.Errorf("%s: pipeline has no stages", path)
+	}
+
+	hasOutput := false
+	for i, st := range p.Stages {
+		if st.Name == "" {
+			st.Name = fmt.Sprintf("stage%d", i+1)
+		}
+		for _, s := range st.Rules {
+			r, err := newRule(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", path, st.Name, err)
+			}
+			st.rules = append(st.rules, r)
+		}
+		if i < len(p.Stages)-1 && st.Follow == "" {
+			return nil, fmt.Errorf("%s: %s: stage has no follow rule", path, st.Name)
+		}
+		hasOutput = hasOutput || st.Output != ""
+	}
+	if !hasOutput {
+		p.Stages[len(p.Stages)-1].Output = "-"
+	}
+	return &p, nil
+}
+
+// run executes the stages in order. Results for stdout are
+// passed to output, those for files are written as json.
+// Failed urls stop the pipeline if strict is set,
+// otherwise they are logged and skipped and run
+// returns errPartial at the end. It also returns
+// errPartial if it stops for -budget or -max-bytes.
+// With -resume it continues from the stage and the urls
+// where a previous run stopped.
+func (p *pipeline) run(seeds []string, output func(map[string]interface{}), strict bool) error {
+	urls := seeds
+	failed := false
+	if len(p.Stages[0].URLs) > 0 {
+		urls = nil
+		for _, u := range p.Stages[0].URLs {
+			urls = append(urls, expandURL(u)...)
+		}
+	}
+
+	start, found := 0, []string(nil)
+	if crawl != nil {
+		if i, us, next, ok := crawl.stage(); ok && i < len(p.Stages) {
+			start, urls, found = i, us, next
+			slog.Info("resuming the crawl", "stage", p.Stages[i].Name, "urls", len(urls), "links", len(next))
+		} else {
+			crawl.startStage(0, urls)
+		}
+	}
+
+	// seen are the urls of all the stages, so that a page is scraped
+	// once in the crawl, and -visited bounds its memory for the crawl
+	seen := visitedMode.newSet()
+	for _, u := range urls {
+		seen.add(u)
+	}
+
+	// -only-new is for the pages of the last stage, the pages of
+	// the others are scraped for their links every time
+	track := onlyNew
+	defer func() { onlyNew = track }()
+	for i := start; i < len(p.Stages); i++ {
+		st := p.Stages[i]
+		onlyNew = nil
+		if i == len(p.Stages)-1 {
+			onlyNew = track
+		}
+		emit := func(m map[string]interface{}) {}
+		switch st.Output {
+		case "":
+		case "-":
+			emit = output
+		default:
+			mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+			if crawl != nil {
+				mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+			}
+			f, err := os.OpenFile(st.Output, mode, 0644)
+			if err != nil {
+				fatal(err)
+			}
+			defer f.Close()
+			enc := json.NewEncoder(f)
+			enc.SetEscapeHTML(false)
+			emit = func(m map[string]interface{}) {
+				if err := enc.Encode(m); err != nil {
+					fatal(err)
+				}
+			}
+		}
+
+		var next []string
+		for _, l := range found {
+			seen.add(l)
+			next = append(next, l)
+		}
+		found = nil
+		pending, stopped := urls, false
+		nextJob := func() *scrapeJob {
+			for len(pending) > 0 {
+				u := pending[0]
+				pending = pending[1:]
+				if *canonical {
+					u = canonicalURL(u)
+				}
+				if overBudget() {
+					stopped = true
+					return nil
+				}
+				if crawl != nil && crawl.done(i, u) {
+					continue
+				}
+				if dedup != nil && dedupURL && dedup.check("url:"+u) {
+					continue
+				}
+				return &scrapeJob{u: u, info: &fetchInfo{FinalURL: u}}
+			}
+			return nil
+		}
+		err := scrapeAll(nextJob, st.rules, false, func(job *scrapeJob) error {
+			u, m, err := job.u, job.m, job.err
+			if err == errDuplicate || err == errEmpty || err == errUnchanged {
+				if crawl != nil {
+					crawl.markDone(i, u, nil)
+				}
+				return nil
+			}
+			if err != nil {
+				runMetrics.fail(err)
+				if strict {
+					return fmt.Errorf("%s: %w", st.Name, err)
+				}
+				slog.Error(err.Error(), "stage", st.Name, "url", u)
+				failed = true
+				return nil
+			}
+			m[*key] = u
+			emit(m)
+
+			var links []string
+			if st.Follow != "" {
+				// links are relative to the page after redirects
+				base, _ := url.Parse(job.info.FinalURL)
+				for _, link := range followLinks(m[st.Follow]) {
+					ref, err := url.Parse(link)
+					if err != nil {
+						continue
+					}
+					abs := base.ResolveReference(ref).String()
+					if *canonical {
+						abs = canonicalURL(abs)
+					}
+					if !seen.add(abs) {
+						links = append(links, abs)
+					}
+				}
+			}
+			next = append(next, links...)
+			if crawl != nil {
+				crawl.markDone(i, u, links)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if stopped {
+			return errPartial
+		}
+		urls = next
+		if crawl != nil && i+1 < len(p.Stages) {
+			crawl.startStage(i+1, urls)
+		}
+	}
+	if failed {
+		return errPartial
+	}
+	return nil
+}
+
+// followLinks returns the links in v, the result of a follow rule
+func followLinks(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var links []string
+		for _, e := range v {
+			links = append(links, followLinks(e)...)
+		}
+		return links
+	}
+	return nil
+}
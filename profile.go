@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+var cpuProfile = flag.String("cpuprofile", "", "Write a cpu profile of the run to `file`, for go tool pprof")
+var memProfile = flag.String("memprofile", "", "Write a heap profile to `file` when humphrey exits, for go tool pprof")
+
+// startProfiling starts the profiles of -cpuprofile and -memprofile.
+// They are written when humphrey exits, also on errors, so that slow
+// or huge runs can be diagnosed where they happen. Long runs can be
+// profiled while running with the pprof handlers of -metrics.
+func startProfiling() error {
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			return err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return err
+		}
+		atExit = append(atExit, func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+	if *memProfile != "" {
+		path := *memProfile
+		atExit = append(atExit, func() {
+			if err := writeHeapProfile(path); err != nil {
+				slog.Error("can't write -memprofile", "error", err)
+			}
+		})
+	}
+	return nil
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// the heap profile is as of the last gc
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+var httpVersion = flag.String("http-version", "", "the http `version` of the requests, 1.1, 2 or 3. By default 2 if the site supports it over tls and 1.1 otherwise")
+
+// setupProtocol returns the transport of client for -http-version,
+// t configured for it or an http/3 transport. With 2 the requests
+// for http urls are sent with h2c, http/2 without tls, for internal
+// services that speak only that. http/3 runs over quic, on udp, and
+// works only for https urls. Its connections follow -resolve and,
+// with guard, refuse private addresses like those of t.
+func setupProtocol(t *http.Transport, pins map[string]string, guard bool) (http.RoundTripper, error) {
+	switch *httpVersion {
+	case "":
+		return t, nil
+	case "1.1", "1":
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetHTTP1(true)
+		return t, nil
+	case "2":
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetHTTP2(true)
+		t.Protocols.SetUnencryptedHTTP2(true)
+		return t, nil
+	case "3":
+		if *unixSocket != "" {
+			return nil, errors.New("-http-version 3 runs over udp, it can't be used with -unix")
+		}
+		dial := func(ctx context.Context, addr string, tlsConf *tls.Config, conf *quic.Config) (*quic.Conn, error) {
+			if pin, ok := pins[strings.ToLower(addr)]; ok {
+				addr = pin
+			}
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+			if err != nil {
+				return nil, err
+			}
+			addr = net.JoinHostPort(ips[0].String(), port)
+			if guard {
+				if err := guardPrivate("udp", addr, nil); err != nil {
+					return nil, err
+				}
+			}
+			return quic.DialAddrEarly(ctx, addr, tlsConf, conf)
+		}
+		return &http3.Transport{TLSClientConfig: t.TLSClientConfig, Dial: dial}, nil
+	}
+	return nil, fmt.Errorf("unknown -http-version: %s", *httpVersion)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// runQuality collects the statistics of the run for -quality
+var runQuality quality
+
+// quality summarizes how well the rules worked over a run, so that
+// scheduled jobs have a single signal to alert on. Score is the
+// fraction of rule values extracted out of all the expected ones,
+// counting every rule of a failed url as missing. Rules and
+// Matched count only the rules applied on the successful urls.
+type quality struct {
+	mu sync.Mutex
+
+	URLs    int `json:"urls"`
+	Failed  int `json:"failed"`
+	Soft404 int `json:"soft404"`
+
+	Expected int `json:"expected"`
+	Rules    int `json:"rules"`
+	Matched  int `json:"matched"`
+	Counted  int `json:"counted"`
+	Passed   int `json:"counts_passed"`
+}
+
+// countError is the error of a rule that violates its cardinality
+type countError struct {
+	rule string
+	n    int
+	c    *cardinality
+}
+
+func (e *countError) Error() string {
+	return fmt.Sprintf("rule %s matched %d elements instead of %s", e.rule, e.n, e.c)
+}
+
+// result records m, the result of the rules on a url
+func (q *quality) result(rules []*rule, m map[string]interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.URLs++
+	q.Expected += len(rules)
+	for _, r := range rules {
+		q.Rules++
+		if !isEmpty(m[r.Name]) {
+			q.Matched++
+		}
+	}
+}
+
+// fail records a failed url
+func (q *quality) fail(rules []*rule) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.URLs++
+	q.Failed++
+	q.Expected += len(rules)
+}
+
+// count records a cardinality check
+func (q *quality) count(ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.Counted++
+	if ok {
+		q.Passed++
+	}
+}
+
+// soft404 records a soft 404
+func (q *quality) soft404() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.Soft404++
+}
+
+// score returns the fraction of expected values extracted
+func (q *quality) score() float64 {
+	if q.Expected == 0 {
+		return 1
+	}
+	return float64(q.Matched) / float64(q.Expected)
+}
+
+// report writes the summary to w as a json object with the rates
+func (q *quality) report(w io.Writer) error {
+	rate := func(n, total int, none float64) float64 {
+		if total == 0 {
+			return none
+		}
+		return float64(n) / float64(total)
+	}
+	return json.NewEncoder(w).Encode(struct {
+		*quality
+		MatchRate   float64 `json:"match_rate"`
+		CountRate   float64 `json:"count_pass_rate"`
+		Soft404Rate float64 `json:"soft404_rate"`
+		ErrorRate   float64 `json:"error_rate"`
+		Score       float64 `json:"score"`
+	}{q, rate(q.Matched, q.Rules, 1), rate(q.Passed, q.Counted, 1),
+		rate(q.Soft404, q.URLs, 0), rate(q.Failed, q.URLs, 0), q.score()})
+}
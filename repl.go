@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// replSamples is the number of values repl shows for each selector
+const replSamples = 5
+
+// repl downloads and parses the page of url u once and then reads
+// rules without their key from in, selector[:attribute] optionally
+// preceded by modifiers like |number:selector, and writes to out the
+// number of matches and sample values. It makes iterating on
+// selectors fast as the page is not downloaded for every guess.
+func repl(u string, in io.Reader, out io.Writer) error {
+	r, _, err := download(u, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return err
+	}
+	doc.Url = r.resp.Request.URL
+	if *removeSel != "" {
+		doc.FindMatcher(compileSelector(*removeSel)).Remove()
+	}
+
+	fmt.Fprintf(out, "%s: type selector[:attribute], with modifiers like |number:selector\n> ", u)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			replEval(doc, line, out)
+		}
+		fmt.Fprint(out, "> ")
+	}
+	fmt.Fprintln(out)
+	return scanner.Err()
+}
+
+// replEval applies s, a rule without its key, to doc and writes the results
+func replEval(doc *goquery.Document, s string, out io.Writer) {
+	if !strings.ContainsAny(s[:1], keyModifiers) {
+		s = *ruleSep + s
+	}
+	rl, err := newRule("value" + s)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return
+	}
+
+	n := len(rl.match(doc))
+	m := make(map[string]interface{})
+	if err := rl.apply(doc, m, true); err != nil {
+		fmt.Fprintln(out, err)
+	}
+	vals, _ := m[rl.Name].([]interface{})
+	fmt.Fprintf(out, "%d matches\n", n)
+	for i, v := range vals {
+		if i == replSamples {
+			fmt.Fprintf(out, "  ... %d more\n", len(vals)-replSamples)
+			break
+		}
+		b, _ := json.Marshal(v)
+		if len(b) > 120 {
+			b = append(b[:117], "..."...)
+		}
+		fmt.Fprintf(out, "  %s\n", b)
+	}
+}
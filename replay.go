@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// archive is a transport that answers requests with the responses
+// saved in an archive, a HAR of -har or a WARC of -warc, instead of
+// the network. With it humphrey replay applies rules to captured
+// pages offline and the same way every time, for tests in CI and for
+// analysing large crawls. Everything else, redirects, status and
+// content checks and the output, works like for live pages.
+type archive struct {
+	responses map[string]*archivedResponse
+	// urls are the urls requested in the archive, in order,
+	// without those only reached by redirects
+	urls []string
+}
+
+// archivedResponse is a response saved in an archive. The body is
+// decoded, the headers have no Content-Encoding.
+type archivedResponse struct {
+	status int
+	proto  string
+	header http.Header
+	body   []byte
+}
+
+func newArchive() *archive {
+	return &archive{responses: make(map[string]*archivedResponse)}
+}
+
+// add adds the response r for url u. Only the first response of a url
+// is kept and urls that are the Location of an earlier redirect are
+// not among the urls of the archive.
+func (a *archive) add(u string, r *archivedResponse, redirected map[string]bool) {
+	if _, ok := a.responses[u]; ok {
+		return
+	}
+	r.header.Del("Content-Encoding")
+	r.header.Del("Content-Length")
+	a.responses[u] = r
+	if !redirected[u] {
+		a.urls = append(a.urls, u)
+	}
+	if loc := r.header.Get("Location"); loc != "" && r.status >= 300 && r.status < 400 {
+		if req, err := http.NewRequest("GET", u, nil); err == nil {
+			if l, err := req.URL.Parse(loc); err == nil {
+				redirected[l.String()] = true
+			}
+		}
+	}
+}
+
+func (a *archive) RoundTrip(req *http.Request) (*http.Response, error) {
+	r, ok := a.responses[req.URL.String()]
+	if !ok || (req.Method != "GET" && req.Method != "HEAD") {
+		return nil, fmt.Errorf("%s %s is not in the archive", req.Method, req.URL)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(r.status) + " " + http.StatusText(r.status),
+		StatusCode:    r.status,
+		Proto:         r.proto,
+		Header:        r.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       req,
+	}, nil
+}
+
+// loadArchive reads the archive at path, a HAR or a WARC
+func loadArchive(path string) (*archive, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	load := loadHAR
+	if isWARC(b) {
+		load = loadWARC
+	}
+	a, err := load(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return a, nil
+}
+
+// loadHAR reads the GET requests of the HAR b that got a response
+func loadHAR(b []byte) (*archive, error) {
+	var l harLog
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, err
+	}
+	a := newArchive()
+	redirected := make(map[string]bool)
+	for _, e := range l.Log.Entries {
+		if e.Request.Method != "GET" || e.Response.Status == 0 {
+			continue
+		}
+		body := []byte(e.Response.Content.Text)
+		if e.Response.Content.Encoding == "base64" {
+			var err error
+			if body, err = base64.StdEncoding.DecodeString(e.Response.Content.Text); err != nil {
+				return nil, fmt.Errorf("%s: %v", e.Request.URL, err)
+			}
+		}
+		h := make(http.Header)
+		for _, nv := range e.Response.Headers {
+			h.Add(nv.Name, nv.Value)
+		}
+		proto := e.Response.HTTPVersion
+		if !strings.HasPrefix(proto, "HTTP/") {
+			proto = "HTTP/1.1"
+		}
+		a.add(e.Request.URL, &archivedResponse{e.Response.Status, proto, h, body}, redirected)
+	}
+	return a, nil
+}
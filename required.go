@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// requiredError is the error for a page where required rules
+// matched nothing. Usually it means the site changed its markup.
+type requiredError struct {
+	URL   string   `json:"url"`
+	Rules []string `json:"rules"`
+}
+
+func (e *requiredError) Error() string {
+	return fmt.Sprintf("required rules %s matched nothing for url: %s",
+		strings.Join(e.Rules, ", "), e.URL)
+}
+
+// report writes the error to w as a json object,
+// so that scripts can tell which rules broke
+func (e *requiredError) report(w io.Writer) error {
+	return json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+		*requiredError
+	}{"required rules matched nothing", e})
+}
+
+// errEmpty is returned with -empty skip for pages
+// where all the rules matched nothing. They are skipped silently.
+var errEmpty = errors.New("empty result")
+
+// checkEmpty applies the -empty policy to m, the result of the rules
+// on url u. It returns nil if m has a value or the policy is emit.
+func checkEmpty(u string, rules []*rule, m map[string]interface{}) error {
+	if *emptyPolicy == "emit" || len(rules) == 0 {
+		return nil
+	}
+	for _, r := range rules {
+		if !isEmpty(m[r.Name]) {
+			return nil
+		}
+	}
+	if *emptyPolicy == "skip" {
+		return errEmpty
+	}
+	return fmt.Errorf("all rules matched nothing for url: %s", u)
+}
+
+// isEmpty reports whether v, the result of a rule,
+// has no value: nil, an empty string or an empty array
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var resumeFile = flag.String("resume", "", "Keep the progress of the crawl in the database `file` and, if it exists, continue the interrupted crawl in it")
+
+// crawl is the state of -resume, nil if disabled
+var crawl *crawlState
+
+// crawlState persists the progress of a crawl, so that a crawl killed
+// by a network failure or a reboot continues where it stopped instead
+// of starting over. It keeps the urls done in every stage of a
+// pipeline, the urls of the current stage, the frontier, and the
+// links found in it for the next stage. For urls from stdin only the
+// urls done are kept. Failed urls are not done and are tried again.
+type crawlState struct {
+	db *bolt.DB
+}
+
+var (
+	visitedBucket  = []byte("visited")
+	frontierBucket = []byte("frontier")
+	nextBucket     = []byte("next")
+)
+
+// openCrawlState opens or creates the state at path. It is closed
+// when humphrey exits.
+func openCrawlState(path string) (*crawlState, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{visitedBucket, frontierBucket, nextBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	atExit = append(atExit, func() { db.Close() })
+	return &crawlState{db}, nil
+}
+
+func visitedKey(stage int, u string) []byte {
+	return []byte(strconv.Itoa(stage) + "\x00" + u)
+}
+
+// done reports whether u was done in stage by a previous run
+func (c *crawlState) done(stage int, u string) bool {
+	var ok bool
+	c.db.View(func(tx *bolt.Tx) error {
+		ok = tx.Bucket(visitedBucket).Get(visitedKey(stage, u)) != nil
+		return nil
+	})
+	return ok
+}
+
+// markDone records that u is done in stage and adds the links
+// found in its page to the frontier of the next stage, together
+func (c *crawlState) markDone(stage int, u string, links []string) {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		next := tx.Bucket(nextBucket)
+		for _, l := range links {
+			seq, err := next.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := next.Put([]byte(fmt.Sprintf("%016x", seq)), []byte(l)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(visitedBucket).Put(visitedKey(stage, u), []byte{})
+	})
+	if err != nil {
+		slog.Warn("can't save the progress of the crawl", "url", u, "error", err)
+	}
+}
+
+// startStage records that the crawl is at stage with the urls
+func (c *crawlState) startStage(stage int, urls []string) {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(urls)
+		if err != nil {
+			return err
+		}
+		f := tx.Bucket(frontierBucket)
+		if err := f.Put([]byte("stage"), []byte(strconv.Itoa(stage))); err != nil {
+			return err
+		}
+		if err := f.Put([]byte("urls"), b); err != nil {
+			return err
+		}
+		if err := tx.DeleteBucket(nextBucket); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket(nextBucket)
+		return err
+	})
+	if err != nil {
+		slog.Warn("can't save the progress of the crawl", "stage", stage, "error", err)
+	}
+}
+
+// stage returns the stage where a previous run stopped, its urls and
+// the links found so far for the next stage. ok is false if there was
+// no previous run.
+func (c *crawlState) stage() (stage int, urls, next []string, ok bool) {
+	c.db.View(func(tx *bolt.Tx) error {
+		f := tx.Bucket(frontierBucket)
+		s := f.Get([]byte("stage"))
+		if s == nil {
+			return nil
+		}
+		stage, _ = strconv.Atoi(string(s))
+		if err := json.Unmarshal(f.Get([]byte("urls")), &urls); err != nil {
+			return nil
+		}
+		ok = true
+		return tx.Bucket(nextBucket).ForEach(func(k, v []byte) error {
+			next = append(next, string(v))
+			return nil
+		})
+	})
+	return
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// route sends the records where field has value to a file
+// instead of the output, written as field=value:file.
+// For arrays it is enough that one of the elements has value.
+type route struct {
+	field string
+	value string
+	path  string
+
+	write func(map[string]interface{})
+}
+
+func parseRoute(s string) (*route, error) {
+	i, j := strings.Index(s, "="), strings.LastIndex(s, ":")
+	if i <= 0 || j < i {
+		return nil, fmt.Errorf("can't parse route: %s", s)
+	}
+	return &route{field: s[:i], value: s[i+1 : j], path: s[j+1:]}, nil
+}
+
+// matches reports whether the record m goes to the route
+func (r *route) matches(m map[string]interface{}) bool {
+	var match func(v interface{}) bool
+	match = func(v interface{}) bool {
+		switch v := v.(type) {
+		case nil:
+			return false
+		case string:
+			return compareKey(v) == compareKey(r.value)
+		case []interface{}:
+			for _, e := range v {
+				if match(e) {
+					return true
+				}
+			}
+			return false
+		default:
+			return fmt.Sprint(v) == r.value
+		}
+	}
+	return match(m[r.field])
+}
+
+// routeOutput returns an output function that writes each record to
+// the first route it matches or, if none, to output. The files of the
+// routes are created and written by the functions newWriter returns,
+// with those that close their formatters, if any. A file that can't
+// be written stops the run like a partial one. Routes with the same
+// file share it and - is stdout. It also returns a function that closes
+// the formatters of the files, syncs and closes the files and returns
+// the first error, so that a file cut short, by a full disk for
+// example, fails the run.
+func routeOutput(specs []string, output func(map[string]interface{}), newWriter func(io.Writer) (func(map[string]interface{}) error, func() error)) (func(map[string]interface{}), func() error, error) {
+	var routes []*route
+	var files []*os.File
+	var closers []func() error
+	closeFiles := func() error {
+		var first error
+		for i, f := range files {
+			var err error
+			if closers[i] != nil {
+				err = closers[i]()
+			}
+			if serr := f.Sync(); err == nil {
+				err = serr
+			}
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil && first == nil {
+				first = fmt.Errorf("route %s: %v", f.Name(), err)
+			}
+		}
+		return first
+	}
+	writers := map[string]func(map[string]interface{}){"-": output}
+	for _, s := range specs {
+		r, err := parseRoute(s)
+		if err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+		if w, ok := writers[r.path]; ok {
+			r.write = w
+		} else {
+			f, err := os.Create(r.path)
+			if err != nil {
+				closeFiles()
+				return nil, nil, err
+			}
+			write, c := newWriter(f)
+			r.write = func(m map[string]interface{}) {
+				if err := write(m); err != nil {
+					slog.Error(fmt.Sprintf("route %s: %v", f.Name(), err))
+					exit(exitPartial)
+				}
+			}
+			files, closers = append(files, f), append(closers, c)
+			writers[r.path] = r.write
+		}
+		routes = append(routes, r)
+	}
+
+	return func(m map[string]interface{}) {
+		for _, r := range routes {
+			if r.matches(m) {
+				r.write(m)
+				return
+			}
+		}
+		output(m)
+	}, closeFiles, nil
+}
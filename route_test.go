@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRouteOutputClose(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")
+	failed := errors.New("flush failed")
+	var closed []string
+	newWriter := func(w io.Writer) (func(map[string]interface{}) error, func() error) {
+		enc := json.NewEncoder(w)
+		return func(m map[string]interface{}) error { return enc.Encode(m) }, func() error {
+			name := w.(*os.File).Name()
+			closed = append(closed, name)
+			if name == b {
+				return failed
+			}
+			return nil
+		}
+	}
+	var rest []map[string]interface{}
+	output := func(m map[string]interface{}) { rest = append(rest, m) }
+
+	write, closeRoutes, err := routeOutput([]string{"kind=a:" + a, "kind=b:" + b}, output, newWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(map[string]interface{}{"kind": "a"})
+	write(map[string]interface{}{"kind": "c"})
+	err = closeRoutes()
+	if err == nil || !strings.Contains(err.Error(), "flush failed") || !strings.Contains(err.Error(), b) {
+		t.Errorf("got error %v, want the one of %s", err, b)
+	}
+	if len(closed) != 2 {
+		t.Errorf("closed the formatters of %v, want both files", closed)
+	}
+	if got, _ := os.ReadFile(a); string(got) != `{"kind":"a"}`+"\n" {
+		t.Errorf("got %q in %s", got, a)
+	}
+	if len(rest) != 1 {
+		t.Errorf("got %d records in the output, want 1", len(rest))
+	}
+}
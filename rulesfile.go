@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var rulesFile = flag.String("rules", "", "Read rules, one per line, from `file`, or from stdin if -, in addition to those of the command line. Blank lines and lines starting with # are skipped")
+
+// readRules returns the rules of the file at path, or of stdin
+// if it is -, one per line, as they would be written on the command
+// line but without the quoting of the shell. Programs that generate
+// rules can write them there.
+func readRules(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		b, err := readOptionFile(path)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	var rules []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rules = append(rules, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading rules from %s: %v", path, err)
+	}
+	return rules, nil
+}
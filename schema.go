@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// schema returns a JSON Schema document for the results of the rules,
+// so that datasets produced by humphrey describe themselves.
+// The annotations of the rules, description, unit and tags,
+// are carried into the properties.
+func schema(rules []*rule, urlKey string, as_array bool) map[string]interface{} {
+	props := map[string]interface{}{
+		urlKey: map[string]interface{}{
+			"type":        "string",
+			"format":      "uri",
+			"description": "the url of the page",
+		},
+	}
+	required := []string{urlKey}
+	for _, r := range rules {
+		base := r.valueSchema()
+		var p map[string]interface{}
+		switch {
+		case as_array:
+			p = map[string]interface{}{"type": "array", "items": base}
+		case r.Slice != nil && r.Slice.Single:
+			p = map[string]interface{}{"anyOf": []interface{}{base, map[string]interface{}{"type": "null"}}}
+		default:
+			p = map[string]interface{}{"anyOf": []interface{}{
+				base,
+				map[string]interface{}{"type": "array", "items": base},
+				map[string]interface{}{"type": "null"},
+			}}
+		}
+		if r.Description != "" {
+			p["description"] = r.Description
+		}
+		if r.Unit != "" {
+			p["x-unit"] = r.Unit
+		}
+		if len(r.Tags) > 0 {
+			p["x-tags"] = r.Tags
+		}
+		props[r.Name] = p
+		if r.Required || *requireAll {
+			required = append(required, r.Name)
+		}
+	}
+	return map[string]interface{}{
+		"$schema":    "https://json-schema.org/draft/2020-12/schema",
+		"type":       "object",
+		"properties": props,
+		"required":   required,
+	}
+}
+
+// valueSchema returns the schema of a single value of the rule.
+// The last transform that converts values decides the type.
+func (r *rule) valueSchema() map[string]interface{} {
+	for i := len(r.Transforms) - 1; i >= 0; i-- {
+		switch r.Transforms[i].Name {
+		case "number":
+			return map[string]interface{}{"type": "number"}
+		case "bool":
+			return map[string]interface{}{"type": "boolean"}
+		case "date":
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		case "money":
+			return map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"amount":   map[string]interface{}{"type": "number"},
+					"currency": map[string]interface{}{"type": []string{"string", "null"}},
+				},
+			}
+		}
+	}
+
+	switch {
+	case r.Selector == "@article" && r.Attribute != "":
+		return map[string]interface{}{"type": []string{"string", "null"}}
+	case r.Selector == "@meta" && !strings.HasSuffix(r.Attribute, "*"):
+		return map[string]interface{}{"type": "string"}
+	case strings.HasPrefix(r.Selector, "@"), r.Attribute == "@table", r.Attribute == "@attrs":
+		return map[string]interface{}{"type": "object"}
+	case strings.HasPrefix(r.Attribute, "{") && strings.HasSuffix(r.Attribute, "}"):
+		props := make(map[string]interface{})
+		for _, attr := range strings.Split(r.Attribute[1:len(r.Attribute)-1], ",") {
+			attr = strings.TrimPrefix(strings.TrimSpace(attr), "@")
+			props[attr] = map[string]interface{}{"type": "string"}
+		}
+		return map[string]interface{}{"type": "object", "properties": props}
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+// writeSchema writes the schema of the rules to w as json
+func writeSchema(w io.Writer, rules []*rule, urlKey string, as_array bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(schema(rules, urlKey, as_array))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	xhtml "golang.org/x/net/html"
+)
+
+// selectors caches the compiled css selectors. The same rules are
+// applied to every page of a batch or a crawl, so each selector is
+// compiled once instead of for every page.
+var selectors sync.Map
+
+// compileSelector returns the matcher of the css selector sel,
+// compiling it the first time. Like goquery does, a bad selector
+// matches nothing. humphrey validate reports them.
+func compileSelector(sel string) goquery.Matcher {
+	if m, ok := selectors.Load(sel); ok {
+		return m.(goquery.Matcher)
+	}
+	var m goquery.Matcher = matchNothing{}
+	if s, err := cascadia.Compile(sel); err == nil {
+		m = s
+	}
+	selectors.Store(sel, m)
+	return m
+}
+
+// matchNothing is the matcher of bad selectors
+type matchNothing struct{}
+
+func (matchNothing) Match(*xhtml.Node) bool                { return false }
+func (matchNothing) MatchAll(*xhtml.Node) []*xhtml.Node    { return nil }
+func (matchNothing) Filter(ns []*xhtml.Node) []*xhtml.Node { return nil }
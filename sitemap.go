@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var sitemapFlag = multiFlagVar("sitemap", "Scrape the urls of the sitemap at `url`, following sitemap indexes. Can be repeated")
+var includeFlag = multiFlagVar("include", "Scrape only the urls of -sitemap that match the `regexp`. Can be repeated")
+var excludeFlag = multiFlagVar("exclude", "Skip the urls of -sitemap that match the `regexp`. Can be repeated")
+var sinceFlag = flag.String("since", "", "Scrape only the urls of -sitemap modified after this `date`, like 2024-01-31, or in the last duration, like 72h")
+
+// sitemapXML is a sitemap, a urlset, or a sitemap index,
+// https://www.sitemaps.org/protocol.html
+type sitemapXML struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// sitemapFilter selects the urls of sitemaps
+type sitemapFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	since   time.Time
+}
+
+func newSitemapFilter(include, exclude []string, since string) (*sitemapFilter, error) {
+	f := &sitemapFilter{}
+	for _, s := range include {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad -include: %v", err)
+		}
+		f.include = append(f.include, re)
+	}
+	for _, s := range exclude {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad -exclude: %v", err)
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	if since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			f.since = time.Now().Add(-d)
+		} else if f.since = parseLastMod(since); f.since.IsZero() {
+			return nil, fmt.Errorf("bad -since: %s is not a date or a duration", since)
+		}
+	}
+	return f, nil
+}
+
+// modified reports whether an entry with lastmod is newer than
+// -since. Entries without a lastmod are kept, they may be new.
+func (f *sitemapFilter) modified(lastmod string) bool {
+	if f.since.IsZero() {
+		return true
+	}
+	t := parseLastMod(lastmod)
+	return t.IsZero() || !t.Before(f.since)
+}
+
+func (f *sitemapFilter) match(u string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(u) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastModLayouts are the W3C datetime formats of lastmod
+var lastModLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02", "2006-01", "2006"}
+
+// parseLastMod returns the time of lastmod, or the zero time
+func parseLastMod(lastmod string) time.Time {
+	lastmod = strings.TrimSpace(lastmod)
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, lastmod); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// sitemapURLs returns the urls of the sitemaps at roots that pass f,
+// in order and without duplicates, and their lastmods. Sitemap indexes
+// are followed to their sitemaps, skipping those not modified since
+// -since. A root that can't be read is an error, a nested sitemap is
+// logged.
+func sitemapURLs(roots []string, f *sitemapFilter) ([]string, map[string]string, error) {
+	var urls []string
+	lastmods := make(map[string]string)
+	seen := make(map[string]bool)
+	var walk func(u string, nested bool) error
+	walk = func(u string, nested bool) error {
+		if seen[u] {
+			return nil
+		}
+		seen[u] = true
+		sm, err := loadSitemap(u)
+		if err != nil {
+			if !nested {
+				return err
+			}
+			slog.Error(err.Error(), "url", u)
+			return nil
+		}
+		for _, e := range sm.Sitemaps {
+			if loc := strings.TrimSpace(e.Loc); loc != "" && f.modified(e.LastMod) {
+				walk(loc, true)
+			}
+		}
+		for _, e := range sm.URLs {
+			loc := strings.TrimSpace(e.Loc)
+			if loc != "" && !seen[loc] && f.match(loc) && f.modified(e.LastMod) {
+				seen[loc] = true
+				urls = append(urls, loc)
+				if lm := strings.TrimSpace(e.LastMod); lm != "" {
+					lastmods[loc] = lm
+				}
+			}
+		}
+		return nil
+	}
+	for _, u := range roots {
+		if err := walk(u, false); err != nil {
+			return nil, nil, err
+		}
+	}
+	return urls, lastmods, nil
+}
+
+// loadSitemap downloads and parses the sitemap at u. Sitemaps can be
+// compressed with gzip, as files, and text files with a url per line.
+func loadSitemap(u string) (*sitemapXML, error) {
+	b, err := fetchResource(u)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	var r io.Reader = b
+	if head, _ := b.r.Peek(2); bytes.Equal(head, []byte{0x1f, 0x8b}) {
+		z, err := gzip.NewReader(b)
+		if err != nil {
+			return nil, fmt.Errorf("bad gzip sitemap: %v for url: %s", err, u)
+		}
+		defer z.Close()
+		r = z
+	}
+	br := bufio.NewReader(r)
+
+	sm := &sitemapXML{}
+	if head, _ := br.Peek(512); !bytes.HasPrefix(bytes.TrimLeft(head, "\ufeff \t\r\n"), []byte("<")) {
+		s := bufio.NewScanner(br)
+		for s.Scan() {
+			if loc := strings.TrimSpace(s.Text()); loc != "" {
+				sm.URLs = append(sm.URLs, sitemapEntry{Loc: loc})
+			}
+		}
+		return sm, s.Err()
+	}
+	if err := xml.NewDecoder(br).Decode(sm); err != nil {
+		return nil, fmt.Errorf("bad sitemap: %v for url: %s", err, u)
+	}
+	if sm.XMLName.Local != "urlset" && sm.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("not a sitemap but %s for url: %s", sm.XMLName.Local, u)
+	}
+	return sm, nil
+}
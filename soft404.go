@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// notFoundRe matches the titles and headings
+// of typical "not found" pages
+var notFoundRe = regexp.MustCompile(`(?i)\b(404|page not found|not found|no longer available|does ?n[o']t exist|could ?n[o']t be found|cannot be found)\b`)
+
+// minBodyText is the length of text below which
+// a page is considered an empty template
+const minBodyText = 32
+
+// soft404 reports whether doc is a page that was served with http 200
+// but is actually a "not found" page. The marker selector, if not empty,
+// is site specific and decides on its own. Otherwise the heuristics
+// check the title and the first heading for not found messages
+// and the body for missing content. The returned string
+// explains why the page was classified as soft 404.
+func soft404(doc *goquery.Document, marker string) (string, bool) {
+	if marker != "" {
+		if doc.Find(marker).Length() > 0 {
+			return fmt.Sprintf("marker %s matched", marker), true
+		}
+		return "", false
+	}
+
+	if title := strings.TrimSpace(doc.Find("title").First().Text()); notFoundRe.MatchString(title) {
+		return fmt.Sprintf("title %q", title), true
+	}
+	if h1 := strings.TrimSpace(doc.Find("h1").First().Text()); notFoundRe.MatchString(h1) {
+		return fmt.Sprintf("heading %q", h1), true
+	}
+	if n := len(strings.TrimSpace(doc.Find("body").Text())); n < minBodyText {
+		return fmt.Sprintf("body has only %d characters", n), true
+	}
+	return "", false
+}
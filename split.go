@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// section is a part of a document searched on its own by
+// findEach. If own is set only the element itself is matched,
+// otherwise the element and all its descendants.
+type section struct {
+	s   *goquery.Selection
+	own bool
+}
+
+// sections splits doc into the html and body elements and the
+// subtrees of their children, in document order. Huge generated
+// reports are usually long lists of top-level sections in body.
+func sections(doc *goquery.Document) []section {
+	var secs []section
+	root := doc.Find("html")
+	secs = append(secs, section{root, true})
+	root.Children().Each(func(i int, c *goquery.Selection) {
+		if !c.Is("body") {
+			secs = append(secs, section{c, false})
+			return
+		}
+		secs = append(secs, section{c, true})
+		c.Children().Each(func(i int, s *goquery.Selection) {
+			secs = append(secs, section{s, false})
+		})
+	})
+	return secs
+}
+
+// findEach calls fn for every element of doc that matches the
+// selector sel and returns the values in document order. With -split
+// the top-level sections of the document are searched by parallel
+// goroutines, each taking a chunk of consecutive sections. Selectors
+// are matched against the whole tree, so combinators like > and +
+// work across sections too.
+func findEach(doc *goquery.Document, sel string, fn func(*goquery.Selection) []interface{}) []interface{} {
+	var vals []interface{}
+	m := compileSelector(sel)
+	if *splitWorkers < 2 {
+		doc.FindMatcher(m).Each(func(i int, s *goquery.Selection) {
+			vals = append(vals, fn(s)...)
+		})
+		return vals
+	}
+
+	secs := sections(doc)
+	chunk := (len(secs) + *splitWorkers*4 - 1) / (*splitWorkers * 4)
+	results := make([][]interface{}, (len(secs)+chunk-1)/chunk)
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < *splitWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				var rs []interface{}
+				each := func(j int, s *goquery.Selection) {
+					rs = append(rs, fn(s)...)
+				}
+				for i := c * chunk; i < len(secs) && i < (c+1)*chunk; i++ {
+					secs[i].s.FilterMatcher(m).Each(each)
+					if !secs[i].own {
+						secs[i].s.FindMatcher(m).Each(each)
+					}
+				}
+				results[c] = rs
+			}
+		}()
+	}
+	for c := range results {
+		work <- c
+	}
+	close(work)
+	wg.Wait()
+
+	for _, rs := range results {
+		vals = append(vals, rs...)
+	}
+	return vals
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	xhtml "golang.org/x/net/html"
+)
+
+var streamParse = flag.Bool("stream", false, "Parse pages as a stream of tags and keep in memory only the elements matched by the rules, for pages too large to parse whole")
+
+// impliedEnd are the elements whose start closes the open elements
+// of closes, if they are the last open ones, up to one of scope.
+// Pages with optional end tags, like tables without </td>, are
+// common and the tokenizer, unlike the parser, does not know them.
+var impliedEnd = map[string]endTags{
+	"li":     {[]string{"li"}, []string{"ul", "ol"}},
+	"dt":     {[]string{"dt", "dd"}, []string{"dl"}},
+	"dd":     {[]string{"dt", "dd"}, []string{"dl"}},
+	"tr":     {[]string{"tr", "td", "th"}, []string{"table", "thead", "tbody", "tfoot"}},
+	"td":     {[]string{"td", "th"}, []string{"tr", "table"}},
+	"th":     {[]string{"td", "th"}, []string{"tr", "table"}},
+	"thead":  {[]string{"thead", "tbody", "tfoot", "tr", "td", "th"}, []string{"table"}},
+	"tbody":  {[]string{"thead", "tbody", "tfoot", "tr", "td", "th"}, []string{"table"}},
+	"tfoot":  {[]string{"thead", "tbody", "tfoot", "tr", "td", "th"}, []string{"table"}},
+	"option": {[]string{"option"}, []string{"select", "datalist"}},
+	// blocks close the paragraph they are in
+	"p": closesP, "div": closesP, "ul": closesP, "ol": closesP, "dl": closesP, "table": closesP,
+	"h1": closesP, "h2": closesP, "h3": closesP, "h4": closesP, "h5": closesP, "h6": closesP,
+	"pre": closesP, "blockquote": closesP, "hr": closesP, "form": closesP, "fieldset": closesP,
+	"section": closesP, "article": closesP, "aside": closesP, "nav": closesP, "header": closesP,
+	"footer": closesP, "main": closesP, "figure": closesP, "details": closesP, "address": closesP,
+}
+
+type endTags struct{ closes, scope []string }
+
+var closesP = endTags{[]string{"p"}, nil}
+
+// voidElements have no end tag and no content
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// checkStream returns an error for the rules and options that need
+// the whole page and don't work with -stream
+func checkStream(rules []*rule) error {
+	switch {
+	case *soft404Check || *soft404Marker != "":
+		return fmt.Errorf("-soft404 needs the whole page and can't be used with -stream")
+	case *debugRulesFlag:
+		return fmt.Errorf("-debug-rules needs the whole page and can't be used with -stream")
+	case len(variants) > 0:
+		return fmt.Errorf("-variants needs the whole page and can't be used with -stream")
+	}
+	for _, r := range rules {
+		for alt := r; alt != nil; alt = alt.Fallback {
+			if strings.HasPrefix(alt.Selector, "@") {
+				return fmt.Errorf("rule %s: %s needs the whole page and can't be used with -stream", r.Name, alt.Selector)
+			}
+		}
+	}
+	return nil
+}
+
+// streamFrame is an open element of a streamed page
+type streamFrame struct {
+	n *xhtml.Node
+	// keep is set if the element or one of its ancestors was matched
+	// by a rule, so its content is kept until it is closed
+	keep    bool
+	removed bool
+	matches []*streamMatch
+}
+
+// streamMatch is an element matched by a rule, with the values
+// of the rule on the element once it is closed
+type streamMatch struct {
+	r    *rule
+	vals []interface{}
+}
+
+// streamRules evaluates the rules on the page read from r like
+// evalRules, without building the document. The page is tokenized
+// and only the ancestors of the current element and its preceding
+// siblings, without their content, are kept, together with the
+// elements matched by the rules until they are closed. Selectors
+// are matched when an element starts, so they can look at its
+// ancestors, its attributes and the elements before it, but not at
+// its content or what follows it, like :has, :contains, :empty or
+// :last-child. Elements matched by -remove are skipped.
+func streamRules(r io.Reader, rules []*rule, as_array bool) ([]interface{}, []error, error) {
+	var alts []*rule
+	for _, rr := range rules {
+		for alt := rr; alt != nil; alt = alt.Fallback {
+			alts = append(alts, alt)
+		}
+	}
+	matchers := make([]goquery.Matcher, len(alts))
+	for i, alt := range alts {
+		matchers[i] = compileSelector(alt.Selector)
+	}
+	// the elements closed are kept, without their content, only for
+	// the selectors on siblings, otherwise the memory is the depth
+	siblings := false
+	for _, alt := range alts {
+		siblings = siblings || siblingSelector(alt.Selector)
+	}
+	var remove goquery.Matcher
+	if *removeSel != "" {
+		remove = compileSelector(*removeSel)
+	}
+
+	// found are the matches of every rule in document order
+	found := make(map[*rule][]*streamMatch)
+	stack := []*streamFrame{{n: &xhtml.Node{Type: xhtml.DocumentNode}}}
+	closeTop := func() {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, m := range f.matches {
+			m.vals = m.r.values(goquery.NewDocumentFromNode(f.n).Selection)
+		}
+		switch parent := stack[len(stack)-1]; {
+		case parent.keep:
+		case siblings:
+			f.n.FirstChild, f.n.LastChild = nil, nil
+		case f.n.Parent != nil:
+			parent.n.RemoveChild(f.n)
+		}
+	}
+	closeTo := func(i int) {
+		for len(stack) > i {
+			closeTop()
+		}
+	}
+	// openIndex returns the index of the last open tag, up to scope, or 0
+	openIndex := func(tag string, scope []string) int {
+		for i := len(stack) - 1; i > 0; i-- {
+			switch d := stack[i].n.Data; {
+			case d == tag:
+				return i
+			case contains(scope, d):
+				return 0
+			}
+		}
+		return 0
+	}
+
+	z := xhtml.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return nil, nil, err
+			}
+			break
+		}
+		top := stack[len(stack)-1]
+		switch tt {
+		case xhtml.TextToken:
+			if top.keep && !top.removed {
+				top.n.AppendChild(&xhtml.Node{Type: xhtml.TextNode, Data: string(z.Text())})
+			}
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			t := z.Token()
+			if ie, ok := impliedEnd[t.Data]; ok {
+				i := len(stack)
+				for i > 1 && contains(ie.closes, stack[i-1].n.Data) {
+					i--
+				}
+				closeTo(i)
+				top = stack[len(stack)-1]
+			}
+			n := &xhtml.Node{Type: xhtml.ElementNode, Data: t.Data, DataAtom: t.DataAtom, Attr: t.Attr}
+			f := &streamFrame{n: n, keep: top.keep, removed: top.removed}
+			if !f.removed {
+				top.n.AppendChild(n)
+				if remove != nil && remove.Match(n) {
+					top.n.RemoveChild(n)
+					f.removed = true
+				}
+			}
+			if !f.removed {
+				for i, m := range matchers {
+					if m.Match(n) {
+						sm := &streamMatch{r: alts[i]}
+						f.matches = append(f.matches, sm)
+						found[alts[i]] = append(found[alts[i]], sm)
+						f.keep = true
+					}
+				}
+			}
+			stack = append(stack, f)
+			if tt == xhtml.SelfClosingTagToken || voidElements[t.Data] {
+				closeTop()
+			}
+		case xhtml.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if i := openIndex(tag, impliedEnd[tag].scope); i > 0 {
+				closeTo(i)
+			}
+		}
+	}
+	closeTo(1)
+
+	vals := make([]interface{}, len(rules))
+	errs := make([]error, len(rules))
+	for i, rr := range rules {
+		var vs []interface{}
+		for alt := rr; alt != nil && len(vs) == 0; alt = alt.Fallback {
+			for _, m := range found[alt] {
+				vs = append(vs, m.vals...)
+			}
+		}
+		vals[i], errs[i] = rr.finish(vs, as_array)
+	}
+	return vals, errs, nil
+}
+
+// siblingSelector reports whether the selector sel may look at the
+// siblings of an element, with + or ~ or a pseudo class like :nth-child
+func siblingSelector(sel string) bool {
+	if strings.ContainsAny(sel, "+~") {
+		return true
+	}
+	for _, p := range []string{":nth-", ":first-", ":last-", ":only-"} {
+		if strings.Contains(sel, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxSpan limits colspan and rowspan like browsers do,
+// so a broken page can't make the grid huge
+const maxSpan = 1000
+
+// table converts the html table s to records, one object per
+// body row. The keys are the header texts, taken from the rows of
+// the thead or, if there is none, from the first row if all its cells
+// are th. Columns without a header are named col1, col2, etc.
+// Cells spanning several columns or rows are repeated in each
+// position they cover, so all the records have the same keys.
+func table(s *goquery.Selection) []interface{} {
+	var head, body []*goquery.Selection
+	s.Find("tr").Each(func(i int, tr *goquery.Selection) {
+		if !tr.Closest("table").IsSelection(s) {
+			return
+		}
+		if tr.ParentFiltered("thead").Length() > 0 {
+			head = append(head, tr)
+		} else {
+			body = append(body, tr)
+		}
+	})
+	if len(head) == 0 && len(body) > 0 {
+		if first := body[0]; first.Children().Length() == first.Children().Filter("th").Length() {
+			head, body = body[:1], body[1:]
+		}
+	}
+
+	var keys []string
+	for _, row := range tableGrid(head) {
+		for i, text := range row {
+			if i >= len(keys) {
+				keys = append(keys, "")
+			}
+			if text != "" && !strings.HasSuffix(keys[i], text) {
+				keys[i] = strings.TrimSpace(keys[i] + " " + text)
+			}
+		}
+	}
+
+	var vals []interface{}
+	for _, row := range tableGrid(body) {
+		rec := make(map[string]interface{})
+		for i := 0; i < len(row) || i < len(keys); i++ {
+			k := fmt.Sprintf("col%d", i+1)
+			if i < len(keys) && keys[i] != "" {
+				k = keys[i]
+			}
+			if i < len(row) {
+				rec[k] = row[i]
+			} else {
+				rec[k] = ""
+			}
+		}
+		vals = append(vals, rec)
+	}
+	return vals
+}
+
+// tableGrid returns the texts of the cells of rows laid out
+// in a grid, with spanning cells expanded
+func tableGrid(rows []*goquery.Selection) [][]string {
+	type carry struct {
+		text string
+		left int
+	}
+	carries := make(map[int]*carry)
+
+	var grid [][]string
+	for _, tr := range rows {
+		var row []string
+		// fill places the cells spanning from previous rows at the
+		// current position. At the end of the row it places them
+		// all, padding the gaps with empty cells.
+		fill := func(end bool) {
+			last := -1
+			if end {
+				for col := range carries {
+					if col > last {
+						last = col
+					}
+				}
+			}
+			for {
+				c, ok := carries[len(row)]
+				if !ok {
+					if len(row) >= last {
+						return
+					}
+					row = append(row, "")
+					continue
+				}
+				row = append(row, c.text)
+				if c.left--; c.left == 0 {
+					delete(carries, len(row)-1)
+				}
+			}
+		}
+		tr.Children().Filter("td, th").Each(func(i int, cell *goquery.Selection) {
+			fill(false)
+			text := strings.TrimSpace(cell.Text())
+			colspan := tableSpan(cell, "colspan")
+			rowspan := tableSpan(cell, "rowspan")
+			for j := 0; j < colspan; j++ {
+				if rowspan > 1 {
+					carries[len(row)] = &carry{text, rowspan - 1}
+				}
+				row = append(row, text)
+			}
+		})
+		fill(true)
+		grid = append(grid, row)
+	}
+	return grid
+}
+
+// tableSpan returns the value of the span attribute of cell
+func tableSpan(cell *goquery.Selection, attr string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(cell.AttrOr(attr, "1")))
+	if err != nil || n < 1 {
+		return 1
+	}
+	if n > maxSpan {
+		return maxSpan
+	}
+	return n
+}
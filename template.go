@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// urlGroupRe matches the groups of url templates, numeric ranges like
+// {1..50}, {01..50} or {0..100..10} and lists like {a,b,c}
+var urlGroupRe = regexp.MustCompile(`\{(-?\d+)\.\.(-?\d+)(?:\.\.([1-9]\d*))?\}|\{([^{}]*,[^{}]*)\}`)
+
+// expandURL returns the urls of the template u, one for every
+// combination of the values of its groups, the last group changing
+// fastest like in the shell. Ranges count down if the start is
+// greater than the end and numbers are padded with zeros to the width
+// of the start, if it begins with a zero. Urls without groups are
+// returned as they are.
+func expandURL(u string) []string {
+	loc := urlGroupRe.FindStringSubmatchIndex(u)
+	if loc == nil {
+		return []string{u}
+	}
+	var values []string
+	if loc[8] >= 0 {
+		values = strings.Split(u[loc[8]:loc[9]], ",")
+	} else {
+		from, to := u[loc[2]:loc[3]], u[loc[4]:loc[5]]
+		start, _ := strconv.Atoi(from)
+		end, _ := strconv.Atoi(to)
+		step := 1
+		if loc[6] >= 0 {
+			step, _ = strconv.Atoi(u[loc[6]:loc[7]])
+		}
+		width := 0
+		if len(strings.TrimPrefix(from, "-")) > 1 && strings.HasPrefix(strings.TrimPrefix(from, "-"), "0") {
+			width = len(from)
+		}
+		if start > end {
+			step = -step
+		}
+		for i := start; (step > 0 && i <= end) || (step < 0 && i >= end); i += step {
+			values = append(values, fmt.Sprintf("%0*d", width, i))
+		}
+	}
+
+	rest := expandURL(u[loc[1]:])
+	urls := make([]string, 0, len(values)*len(rest))
+	for _, v := range values {
+		for _, r := range rest {
+			urls = append(urls, u[:loc[0]]+v+r)
+		}
+	}
+	return urls
+}
+
+// urlScanner reads urls, one per line, like a bufio.Scanner and
+// expands the url templates among them. A line can have a label after
+// the url, separated by a tab, like an id of the user for the page.
+// If literal is set the urls are not templates, like those of sitemaps.
+type urlScanner struct {
+	s       *bufio.Scanner
+	pending []string
+	cur     string
+	label   string
+	literal bool
+}
+
+func newURLScanner(r io.Reader) *urlScanner {
+	return &urlScanner{s: bufio.NewScanner(r)}
+}
+
+func (s *urlScanner) Scan() bool {
+	for len(s.pending) == 0 {
+		if !s.s.Scan() {
+			return false
+		}
+		u, label, _ := strings.Cut(s.s.Text(), "\t")
+		if s.pending = []string{strings.TrimSpace(u)}; !s.literal {
+			s.pending = expandURL(s.pending[0])
+		}
+		s.label = strings.TrimSpace(label)
+	}
+	s.cur, s.pending = s.pending[0], s.pending[1:]
+	return true
+}
+
+// Text returns the url read by the last Scan
+func (s *urlScanner) Text() string {
+	return s.cur
+}
+
+// Label returns the label of the url read by the last Scan, or "".
+// The urls of a template share its label.
+func (s *urlScanner) Label() string {
+	return s.label
+}
+
+func (s *urlScanner) Err() error {
+	return s.s.Err()
+}
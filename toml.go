@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+
+	"github.com/BurntSushi/toml"
+)
+
+// tomlFormat writes each result as a [[result]] table, so that the
+// output of a run is one toml document with an array of tables.
+// toml has no null, so rules that matched nothing are left out.
+type tomlFormat struct {
+	w io.Writer
+}
+
+func newTOMLFormat(w io.Writer, rules []*rule) (formatter, error) {
+	return &tomlFormat{w}, nil
+}
+
+func (f *tomlFormat) write(m map[string]interface{}) error {
+	doc := map[string]interface{}{"result": []interface{}{withoutNulls(m)}}
+	return toml.NewEncoder(f.w).Encode(doc)
+}
+
+// withoutNulls returns v without the nulls of its objects and arrays
+func withoutNulls(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		o := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			if e != nil {
+				o[k] = withoutNulls(e)
+			}
+		}
+		return o
+	case []interface{}:
+		a := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			if e != nil {
+				a = append(a, withoutNulls(e))
+			}
+		}
+		return a
+	}
+	return v
+}
+
+func (f *tomlFormat) close() error {
+	return nil
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/currency"
+)
+
+// transform converts the values extracted by a rule, written
+// after the name like a template pipeline: |name or |name(arg).
+// Transforms are applied in order to every string value,
+// including those inside objects and arrays.
+// List transforms, like |unique, take all the values at once.
+type transform struct {
+	Name string
+	Arg  string
+
+	fn   transformFunc
+	list listFunc
+}
+
+// transformFunc converts the value s. It is called with the argument
+// of the transform, empty if there is none.
+type transformFunc func(s, arg string) (interface{}, error)
+
+// listFunc converts the values of a rule
+type listFunc func(vals []interface{}, arg string) []interface{}
+
+// transformDef is a transform known to the rule parser.
+// It has either fn or list.
+type transformDef struct {
+	syntax
+	name string
+	fn   transformFunc
+	list listFunc
+}
+
+// transformDefs lists the transforms. describe and
+// usage show them from here so keep it documented.
+var transformDefs = []transformDef{
+	{syntax{"|number", "a json number, ignoring currency symbols and thousands separators"}, "number", toNumber, nil},
+	{syntax{"|money(currency)", "an object with the amount and the currency, detected from symbols or ISO codes, or currency if none"}, "money", toMoney, nil},
+	{syntax{"|bool", "a json boolean from true/false, yes/no, on/off or 1/0"}, "bool", toBool, nil},
+	{syntax{"|date(layout)", "an RFC3339 timestamp parsed with the go time layout, or common layouts if omitted"}, "date", toDate, nil},
+	{syntax{"|re(regexp)", "the first group of the regular expression matched in the string, or the whole match if it has no groups"}, "re", toMatch, nil},
+	{syntax{"|squash", "the string with runs of spaces, tabs and newlines collapsed to one space"}, "squash", toSquash, nil},
+	{syntax{"|lower", "the string in lower case according to -locale"}, "lower", toLower, nil},
+	{syntax{"|upper", "the string in upper case according to -locale"}, "upper", toUpper, nil},
+	{syntax{"|fold", "the string case folded according to -locale, for comparing values"}, "fold", toFold, nil},
+	{syntax{"|unique", "the values without duplicates, keeping the first. With -fold it ignores case and accents"}, "unique", nil, unique},
+	{syntax{"|sort(desc)", "the values sorted, numerically if they are numbers, according to -locale with -fold"}, "sort", nil, sortValues},
+}
+
+// globalTransforms are applied to the values of every rule before
+// its own transforms. They are set by -squash and -case.
+// finalTransforms, set by -unique and -sort, are applied after them.
+var globalTransforms, finalTransforms []*transform
+
+// newTransform returns the transform with the name and arg
+func newTransform(name, arg string) (*transform, error) {
+	for _, d := range transformDefs {
+		if d.name == name {
+			return &transform{name, arg, d.fn, d.list}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown transform: %s", name)
+}
+
+// apply converts v. Strings are converted, objects and arrays
+// are walked and other values are returned as they are.
+func (t *transform) apply(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return t.fn(v, t.Arg)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			c, err := t.apply(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c, err := t.apply(e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = c
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// unique removes the duplicate values. Values are compared
+// by their compareKey, objects and arrays by their json.
+func unique(vals []interface{}, arg string) []interface{} {
+	seen := make(map[string]bool)
+	out := vals[:0:0]
+	for _, v := range vals {
+		k := valueKey(v)
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// sortValues sorts the values, numerically if all of them are numbers
+// and by their compareKey otherwise. The sort is stable and the
+// argument desc reverses it.
+func sortValues(vals []interface{}, arg string) []interface{} {
+	numbers := true
+	for _, v := range vals {
+		if _, ok := v.(float64); !ok {
+			numbers = false
+		}
+	}
+	less := func(a, b interface{}) bool {
+		if numbers {
+			return a.(float64) < b.(float64)
+		}
+		return valueKey(a) < valueKey(b)
+	}
+	out := append(vals[:0:0], vals...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if arg == "desc" {
+			return less(out[j], out[i])
+		}
+		return less(out[i], out[j])
+	})
+	return out
+}
+
+// valueKey returns the key for comparing v with other values
+func valueKey(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return compareKey(s)
+	}
+	b, _ := json.Marshal(v)
+	return compareKey(string(b))
+}
+
+// toNumber parses the first number of strings like "1,299.00 €",
+// "€ 1.299,00" or "-12".
+// When both , and . appear, the last one is the decimal separator.
+// When only one of them appears once, followed by exactly three
+// digits, it is a thousands separator, otherwise it is decimal.
+func toNumber(s, arg string) (interface{}, error) {
+	n, err := parseNumber(s)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// numberRe matches the first number of a string, with its sign and
+// separators, including spaces between groups of three digits like
+// in "1 299,00 €"
+var numberRe = regexp.MustCompile(`-?\d+(?:[.,]\d+|[ \x{a0}\x{202f}]\d{3}\b)*`)
+
+// parseNumber parses the first number of s, so that "$10 $20" is 10
+// and "3 items, 2 left" is 3, as toNumber describes
+func parseNumber(s string) (float64, error) {
+	t := numberRe.FindString(s)
+	t = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "").Replace(t)
+
+	dot, comma := strings.LastIndexByte(t, '.'), strings.LastIndexByte(t, ',')
+	var decimal byte
+	switch {
+	case dot >= 0 && comma >= 0:
+		decimal = '.'
+		if comma > dot {
+			decimal = ','
+		}
+	case dot >= 0 || comma >= 0:
+		sep := byte('.')
+		i := dot
+		if comma >= 0 {
+			sep, i = ',', comma
+		}
+		if strings.Count(t, string(sep)) == 1 && len(t)-i-1 != 3 {
+			decimal = sep
+		}
+	}
+
+	var clean strings.Builder
+	for i := 0; i < len(t); i++ {
+		switch c := t[i]; {
+		case c == decimal:
+			clean.WriteByte('.')
+		case c == '.' || c == ',':
+		default:
+			clean.WriteByte(c)
+		}
+	}
+
+	n, err := strconv.ParseFloat(clean.String(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("can't convert %q to number", s)
+	}
+	return n, nil
+}
+
+// currencySymbols maps symbols to ISO 4217 codes. Longer symbols
+// come first so that US$ is not taken for $.
+var currencySymbols = []struct{ symbol, code string }{
+	{"US$", "USD"}, {"C$", "CAD"}, {"A$", "AUD"}, {"NZ$", "NZD"}, {"HK$", "HKD"},
+	{"R$", "BRL"}, {"zł", "PLN"}, {"kr", "SEK"}, {"Kč", "CZK"},
+	{"€", "EUR"}, {"$", "USD"}, {"£", "GBP"}, {"¥", "JPY"}, {"₹", "INR"},
+	{"₽", "RUB"}, {"₺", "TRY"}, {"₩", "KRW"}, {"₪", "ILS"}, {"₴", "UAH"},
+}
+
+// currencyCodeRe matches words that may be ISO 4217 codes. Only
+// those that currency.ParseISO knows are taken, so that "NEW 12.50"
+// has no currency.
+var currencyCodeRe = regexp.MustCompile(`\b[A-Z]{3}\b`)
+
+// currencyCode returns the first ISO 4217 code in s, or ""
+func currencyCode(s string) string {
+	for _, w := range currencyCodeRe.FindAllString(s, -1) {
+		if _, err := currency.ParseISO(w); err == nil {
+			return w
+		}
+	}
+	return ""
+}
+
+// toMoney parses prices like "€ 1.299,00", "1,299.00 USD" or "US$5"
+// into {"amount": 1299, "currency": "EUR"}. The currency is an ISO code
+// found in s, or the code of a currency symbol, or arg if there is neither.
+func toMoney(s, arg string) (interface{}, error) {
+	amount, err := parseNumber(s)
+	if err != nil {
+		return nil, err
+	}
+	code := currencyCode(s)
+	if code == "" {
+		for _, c := range currencySymbols {
+			if strings.Contains(s, c.symbol) {
+				code = c.code
+				break
+			}
+		}
+	}
+	if code == "" {
+		code = arg
+	}
+	m := map[string]interface{}{"amount": amount, "currency": nil}
+	if code != "" {
+		m["currency"] = code
+	}
+	return m, nil
+}
+
+// toSquash collapses the whitespace of pretty printed html
+func toSquash(s, arg string) (interface{}, error) {
+	return strings.Join(strings.Fields(s), " "), nil
+}
+
+func toLower(s, arg string) (interface{}, error) {
+	return cases.Lower(locale).String(s), nil
+}
+
+func toUpper(s, arg string) (interface{}, error) {
+	return cases.Upper(locale).String(s), nil
+}
+
+// toBool parses booleans in the ways html usually writes them
+func toBool(s, arg string) (interface{}, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "yes", "y", "on", "1":
+		return true, nil
+	case "false", "no", "n", "off", "0":
+		return false, nil
+	}
+	return nil, fmt.Errorf("can't convert %q to bool", s)
+}
+
+// dateLayouts are tried in order by |date without layout
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// toDate parses s with the layout arg, or the common layouts
+// if arg is empty, and formats it as RFC3339
+func toDate(s, arg string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	layouts := dateLayouts
+	if arg != "" {
+		layouts = []string{arg}
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t.Format(time.RFC3339), nil
+		}
+	}
+	return nil, fmt.Errorf("can't convert %q to date", s)
+}
+
+// regexps caches the compiled expressions of |re
+var regexps sync.Map
+
+// toMatch returns the first group of the regular expression arg
+// in s, or the match if it has no groups
+func toMatch(s, arg string) (interface{}, error) {
+	var re *regexp.Regexp
+	if v, ok := regexps.Load(arg); ok {
+		re = v.(*regexp.Regexp)
+	} else {
+		var err error
+		if re, err = regexp.Compile(arg); err != nil {
+			return nil, fmt.Errorf("bad regular expression %q: %v", arg, err)
+		}
+		regexps.Store(arg, re)
+	}
+	m := re.FindStringSubmatch(s)
+	switch {
+	case m == nil:
+		return nil, fmt.Errorf("%q does not match %s", s, arg)
+	case len(m) > 1:
+		return m[1], nil
+	}
+	return m[0], nil
+}
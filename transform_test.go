@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want float64
+	}{
+		{"1,299.00 €", 1299},
+		{"€ 1.299,00", 1299},
+		{"-12", -12},
+		{"12.5", 12.5},
+		{"1,000", 1000},
+		{"1 299,50 €", 1299.5},
+		{"1 299", 1299},
+		{"$10 $20", 10},
+		{"$10, $20", 10},
+		{"3 items, 2 left", 3},
+		{"was 1,299.00 now 999.00", 1299},
+		{"Rating: 4.5 of 5", 4.5},
+		{"in-stock 7", 7},
+	} {
+		got, err := parseNumber(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("parseNumber(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+	for _, in := range []string{"", "n/a", "-", "..."} {
+		if _, err := parseNumber(in); err == nil {
+			t.Errorf("parseNumber(%q) has no error", in)
+		}
+	}
+}
+
+func TestToMoney(t *testing.T) {
+	for _, tc := range []struct {
+		in, arg  string
+		amount   float64
+		currency interface{}
+	}{
+		{"€ 1.299,00", "", 1299, "EUR"},
+		{"1,299.00 USD", "", 1299, "USD"},
+		{"US$5", "", 5, "USD"},
+		{"NEW 12.50", "", 12.5, nil},
+		{"HOT 5", "", 5, nil},
+		{"NEW 12.50 GBP", "", 12.5, "GBP"},
+		{"SALE 12.50 €", "", 12.5, "EUR"},
+		{"NEW 12.50", "CHF", 12.5, "CHF"},
+	} {
+		v, err := toMoney(tc.in, tc.arg)
+		if err != nil {
+			t.Errorf("toMoney(%q): %v", tc.in, err)
+			continue
+		}
+		m := v.(map[string]interface{})
+		if m["amount"] != tc.amount || m["currency"] != tc.currency {
+			t.Errorf("toMoney(%q, %q) = %v, want %v %v", tc.in, tc.arg, m, tc.amount, tc.currency)
+		}
+	}
+}
+
+func TestDefaultOnConversionFailure(t *testing.T) {
+	for _, tc := range []struct {
+		rule string
+		vals []interface{}
+		want interface{}
+		err  bool
+	}{
+		{`price|number?="0":.price`, []interface{}{"12", "n/a"}, []interface{}{12.0, "0"}, false},
+		{`price|number?="0":.price`, []interface{}{"n/a"}, "0", false},
+		{`price|number?="0":.price`, nil, "0", false},
+		{`price|money|re(x)?="none":.price`, []interface{}{"call us"}, "none", false},
+		{`price|number:.price`, []interface{}{"12", "n/a"}, []interface{}{12.0, nil}, true},
+		{"name=price; sel=.price; type=number; default=0", []interface{}{"n/a"}, "0", false},
+	} {
+		var r *rule
+		var err error
+		if strings.Contains(tc.rule, "sel=") {
+			r, err = newLongRule(tc.rule)
+		} else {
+			r, err = newRule(tc.rule)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := r.finish(tc.vals, false)
+		if (err != nil) != tc.err || !reflect.DeepEqual(v, tc.want) {
+			t.Errorf("%s on %q = %#v, %v, want %#v", tc.rule, tc.vals, v, err, tc.want)
+		}
+	}
+}
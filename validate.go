@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+)
+
+// validate checks the rules of the options, already parsed, and
+// those of args without fetching anything and writes all the
+// problems to w, one per line, instead of stopping at the first.
+// Besides the syntax it compiles the css selectors, which
+// otherwise just match nothing when they are bad, checks the
+// builtin selectors and pseudo attributes and finds rules whose
+// names collide. It returns the number of problems.
+func validate(w io.Writer, rules []*rule, args []string) int {
+	problems := 0
+	report := func(format string, a ...interface{}) {
+		fmt.Fprintf(w, format+"\n", a...)
+		problems++
+	}
+
+	names := make(map[string]string)
+	check := func(r *rule, s string) {
+		if prev, ok := names[r.Name]; ok {
+			report("rule %s: the name is also used by %s, the last one overwrites the result", s, prev)
+		} else {
+			names[r.Name] = s
+		}
+		if r.Name == *key {
+			report("rule %s: the name is the url key, rename the rule or use -key", s)
+		}
+		for alt := r; alt != nil; alt = alt.Fallback {
+			for _, p := range validateAlternative(alt) {
+				report("rule %s: %s", s, p)
+			}
+		}
+	}
+	for _, r := range rules {
+		check(r, r.Name)
+	}
+	for _, s := range args {
+		r, err := newRule(s)
+		if err != nil {
+			report("%v", err)
+			continue
+		}
+		check(r, s)
+	}
+	return problems
+}
+
+// validateAlternative returns the problems of the selector,
+// exclude selector and attribute of an alternative of a rule
+func validateAlternative(r *rule) []string {
+	var problems []string
+	if strings.HasPrefix(r.Selector, "@") {
+		if !hasSyntax(builtinSelectors, r.Selector) {
+			problems = append(problems, fmt.Sprintf("unknown builtin selector: %s", r.Selector))
+		}
+		return problems
+	}
+
+	if _, err := cascadia.Compile(r.Selector); err != nil {
+		problems = append(problems, fmt.Sprintf("bad selector %q: %v", r.Selector, err))
+	}
+	if r.Exclude != "" {
+		if _, err := cascadia.Compile(r.Exclude); err != nil {
+			problems = append(problems, fmt.Sprintf("bad exclude selector %q: %v", r.Exclude, err))
+		}
+	}
+
+	attrs := []string{r.Attribute}
+	if strings.HasPrefix(r.Attribute, "{") && strings.HasSuffix(r.Attribute, "}") {
+		attrs = strings.Split(r.Attribute[1:len(r.Attribute)-1], ",")
+		for _, a := range attrs {
+			if a = strings.TrimSpace(a); a == "@attrs" || a == "@table" {
+				problems = append(problems, fmt.Sprintf("%s can't be in an attribute list", a))
+			}
+		}
+	}
+	for _, a := range attrs {
+		if a = strings.TrimSpace(a); strings.HasPrefix(a, "@") && !hasSyntax(pseudoAttributes, a) {
+			problems = append(problems, fmt.Sprintf("unknown pseudo attribute: %s", a))
+		}
+	}
+	return problems
+}
+
+// hasSyntax tells if name is the syntax of one of ss
+func hasSyntax(ss []syntax, name string) bool {
+	for _, s := range ss {
+		if s.Syntax == name {
+			return true
+		}
+	}
+	return false
+}
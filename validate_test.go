@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValidateOptionRules(t *testing.T) {
+	saved := *longRules
+	defer func() { *longRules = saved }()
+	*longRules = multiFlag{
+		"name=price; sel=.price; re=([0-9.]+)",
+		"name=title; sel=h1[",
+	}
+
+	rules, err := optionRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	n := validate(&out, rules, []string{"price:.amount"})
+	if n != 2 {
+		t.Fatalf("got %d problems, want 2:\n%s", n, out.String())
+	}
+	for _, want := range []string{"rule title: bad selector", "rule price:.amount: the name is also used by price"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing problem %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestValidateOptionRulesOk(t *testing.T) {
+	saved := *longRules
+	defer func() { *longRules = saved }()
+	*longRules = multiFlag{"name=price; sel=.price; re=([0-9.]+)"}
+
+	rules, err := optionRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("got %d rules, want 1", len(rules))
+	}
+	var out bytes.Buffer
+	if n := validate(&out, rules, []string{"title:h1"}); n != 0 {
+		t.Errorf("got %d problems, want 0:\n%s", n, out.String())
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// variant pins a site to a specific country, language or currency
+// variant of its pages. Headers, Cookies and Query are added to every
+// request for the domain. Assert, if set, is a rule applied to every
+// downloaded page of the domain whose result must be Value, otherwise
+// the page is rejected. It protects against sites that silently
+// switch variant by geolocation. Header and cookie values like
+// env:TOKEN are replaced by the environment variable TOKEN.
+type variant struct {
+	Headers map[string]string `json:"headers"`
+	Cookies map[string]string `json:"cookies"`
+	Query   map[string]string `json:"query"`
+	Assert  *struct {
+		Rule  string `json:"rule"`
+		Value string `json:"value"`
+	} `json:"assert"`
+
+	assert *rule
+}
+
+// variants maps domains to their variant settings
+var variants map[string]*variant
+
+// loadVariants reads the variants from the json file at path.
+// The file is an object whose keys are domains and values
+// the variant settings for the domain and its subdomains.
+func loadVariants(path string) (map[string]*variant, error) {
+	b, err := readOptionFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var vs map[string]*variant
+	if err := json.Unmarshal(b, &vs); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for domain, v := range vs {
+		for _, m := range []map[string]string{v.Headers, v.Cookies} {
+			for k, val := range m {
+				s, err := secret(val)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s: %s: %v", path, domain, k, err)
+				}
+				m[k] = s
+			}
+		}
+		if v.Assert != nil {
+			r, err := newRule(v.Assert.Rule)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", path, domain, err)
+			}
+			v.assert = r
+		}
+	}
+	return vs, nil
+}
+
+// variantFor returns the variant for the host of u or nil
+// if there is none. A variant for example.com also
+// applies to www.example.com.
+func variantFor(u *url.URL) *variant {
+	host := strings.ToLower(u.Hostname())
+	for {
+		if v, ok := variants[host]; ok {
+			return v
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return nil
+		}
+		host = host[i+1:]
+	}
+}
+
+// apply adds the headers, cookies and query parameters to req
+func (v *variant) apply(req *http.Request) {
+	for k, val := range v.Headers {
+		req.Header.Set(k, val)
+	}
+	for k, val := range v.Cookies {
+		req.AddCookie(&http.Cookie{Name: k, Value: val})
+	}
+	if len(v.Query) > 0 {
+		q := req.URL.Query()
+		for k, val := range v.Query {
+			q.Set(k, val)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+}
+
+// verify checks that the page is the expected variant
+func (v *variant) verify(doc *goquery.Document) error {
+	if v.assert == nil {
+		return nil
+	}
+
+	m := make(map[string]interface{})
+	if err := v.assert.apply(doc, m, false); err != nil {
+		return err
+	}
+	if got, _ := m[v.assert.Name].(string); got != v.Assert.Value {
+		return fmt.Errorf("variant check failed: %s is %q instead of %q",
+			v.assert.Name, got, v.Assert.Value)
+	}
+	return nil
+}
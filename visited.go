@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var visitedMode = visitedFlagVar("visited", "the set of the links seen by all the stages of a pipeline: exact, or bloom:`N:P` for a bloom filter of N links, like 100M, with a false positive rate P, like 0.1%, for crawls of millions of urls")
+
+// visitedSet is the set of the urls seen by a crawl
+type visitedSet interface {
+	// add adds u and reports whether it was already in the set
+	add(u string) bool
+}
+
+// exactSet is a visitedSet that remembers every url
+type exactSet map[string]bool
+
+func (s exactSet) add(u string) bool {
+	if s[u] {
+		return true
+	}
+	s[u] = true
+	return false
+}
+
+// bloomSet is a visitedSet of bounded memory. It never forgets a url
+// but, at the rate it was made for, it finds urls it has not seen,
+// which are then skipped.
+type bloomSet struct {
+	bits   []uint64
+	m      uint64
+	k      uint64
+	s1, s2 maphash.Seed
+}
+
+// newBloomSet returns a bloom filter for n urls with false positive rate p
+func newBloomSet(n, p float64) *bloomSet {
+	m := uint64(math.Ceil(-n * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomSet{bits: make([]uint64, (m+63)/64), m: m, k: k, s1: maphash.MakeSeed(), s2: maphash.MakeSeed()}
+}
+
+func (s *bloomSet) add(u string) bool {
+	// the k positions are derived from two hashes
+	h1, h2 := maphash.String(s.s1, u), maphash.String(s.s2, u)|1
+	seen := true
+	for i := uint64(0); i < s.k; i++ {
+		b := (h1 + i*h2) % s.m
+		if s.bits[b/64]&(1<<(b%64)) == 0 {
+			seen = false
+			s.bits[b/64] |= 1 << (b % 64)
+		}
+	}
+	return seen
+}
+
+// visitedFlag is a flag.Value for the kind of visitedSet
+type visitedFlag struct {
+	s    string
+	n, p float64
+}
+
+func (f *visitedFlag) String() string {
+	return f.s
+}
+
+func (f *visitedFlag) Set(s string) error {
+	if s == "exact" {
+		*f = visitedFlag{s: s}
+		return nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 || parts[0] != "bloom" {
+		return fmt.Errorf("not exact or bloom:N:P")
+	}
+	n, err := parseCount(parts[1])
+	if err != nil || n < 1 {
+		return fmt.Errorf("bad number of urls: %s", parts[1])
+	}
+	rate := strings.TrimSuffix(parts[2], "%")
+	p, err := strconv.ParseFloat(rate, 64)
+	if rate != parts[2] {
+		p /= 100
+	}
+	if err != nil || p <= 0 || p >= 1 {
+		return fmt.Errorf("bad false positive rate: %s", parts[2])
+	}
+	*f = visitedFlag{s, n, p}
+	return nil
+}
+
+// newSet returns an empty set of the kind of f
+func (f *visitedFlag) newSet() visitedSet {
+	if f.n > 0 {
+		return newBloomSet(f.n, f.p)
+	}
+	return make(exactSet)
+}
+
+// parseCount parses a count with an optional K, M or G suffix
+func parseCount(s string) (float64, error) {
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult, s = 1e3, strings.TrimSuffix(s, "K")
+	case strings.HasSuffix(s, "M"):
+		mult, s = 1e6, strings.TrimSuffix(s, "M")
+	case strings.HasSuffix(s, "G"):
+		mult, s = 1e9, strings.TrimSuffix(s, "G")
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	return n * mult, err
+}
+
+// visitedFlagVar defines a flag for the kind of visitedSet, exact by default
+func visitedFlagVar(name, usage string) *visitedFlag {
+	f := &visitedFlag{s: "exact"}
+	flag.Var(f, name, usage)
+	return f
+}
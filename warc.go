@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var warcFile = flag.String("warc", "", "Write the pages fetched, the raw requests and responses, in a WARC `file`, compressed if it ends in .gz")
+
+// warcWriter is a transport that writes the requests sent through rt
+// and their responses in a WARC 1.1 file, the ISO 28500 format of web
+// archives, so that the raw pages of a crawl are kept along with the
+// data extracted from them. A response is written when its body is
+// closed, with the bytes as they came from the server, only without
+// chunking. Responses humphrey did not read to the end, like those
+// over -max-body or of the wrong Content-Type, are marked truncated.
+type warcWriter struct {
+	rt   http.RoundTripper
+	mu   sync.Mutex
+	f    *os.File
+	gzip bool
+}
+
+// warcRecord is a record of a WARC file
+type warcRecord struct {
+	typ     string
+	target  string
+	date    time.Time
+	header  [][2]string
+	block   []byte
+	payload []byte
+}
+
+func newWARCWriter(rt http.RoundTripper, path string) (*warcWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &warcWriter{rt: rt, f: f, gzip: strings.HasSuffix(path, ".gz")}
+	info := "software: humphrey/1.0.0\r\nformat: WARC File Format 1.1\r\n" +
+		"conformsTo: https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"
+	err = w.write(&warcRecord{
+		typ:    "warcinfo",
+		date:   time.Now(),
+		header: [][2]string{{"WARC-Filename", path}, {"Content-Type", "application/warc-fields"}},
+		block:  []byte(info),
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *warcWriter) RoundTrip(req *http.Request) (*http.Response, error) {
+	date := time.Now()
+	resp, err := w.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	reqID := warcID()
+	var body []byte
+	if req.GetBody != nil {
+		if r, err := req.GetBody(); err == nil {
+			body, _ = io.ReadAll(r)
+		}
+	}
+	reqRec := &warcRecord{
+		typ:     "request",
+		target:  req.URL.String(),
+		date:    date,
+		header:  [][2]string{{"WARC-Record-ID", reqID}, {"Content-Type", "application/http;msgtype=request"}},
+		block:   append(warcRequestHead(req), body...),
+		payload: body,
+	}
+
+	resp.Body = &tapBody{ReadCloser: resp.Body, closed: func(b *tapBody) {
+		b.mu.Lock()
+		payload := append([]byte(nil), b.buf.Bytes()...)
+		eof := b.eof
+		b.mu.Unlock()
+		rec := &warcRecord{
+			typ:    "response",
+			target: req.URL.String(),
+			date:   date,
+			header: [][2]string{
+				{"WARC-Concurrent-To", reqID},
+				{"Content-Type", "application/http;msgtype=response"},
+			},
+			block:   append(warcResponseHead(resp), payload...),
+			payload: payload,
+		}
+		if !eof {
+			rec.header = append(rec.header, [2]string{"WARC-Truncated", "length"})
+		}
+		if err := w.write(reqRec, rec); err != nil {
+			slog.Error("can't write -warc", "url", req.URL.String(), "error", err)
+		}
+	}}
+	return resp, nil
+}
+
+// write appends the records to the file, together
+func (w *warcWriter) write(recs ...*warcRecord) error {
+	var buf bytes.Buffer
+	for _, r := range recs {
+		var rb bytes.Buffer
+		rb.WriteString("WARC/1.1\r\n")
+		fmt.Fprintf(&rb, "WARC-Type: %s\r\n", r.typ)
+		if !hasField(r.header, "WARC-Record-ID") {
+			fmt.Fprintf(&rb, "WARC-Record-ID: %s\r\n", warcID())
+		}
+		fmt.Fprintf(&rb, "WARC-Date: %s\r\n", r.date.UTC().Format(time.RFC3339Nano))
+		if r.target != "" {
+			fmt.Fprintf(&rb, "WARC-Target-URI: %s\r\n", r.target)
+		}
+		for _, f := range r.header {
+			fmt.Fprintf(&rb, "%s: %s\r\n", f[0], f[1])
+		}
+		if r.typ == "request" || r.typ == "response" {
+			fmt.Fprintf(&rb, "WARC-Block-Digest: %s\r\n", warcDigest(r.block))
+		}
+		if r.typ == "response" || len(r.payload) > 0 {
+			fmt.Fprintf(&rb, "WARC-Payload-Digest: %s\r\n", warcDigest(r.payload))
+		}
+		fmt.Fprintf(&rb, "Content-Length: %d\r\n\r\n", len(r.block))
+		rb.Write(r.block)
+		rb.WriteString("\r\n\r\n")
+
+		if !w.gzip {
+			buf.Write(rb.Bytes())
+			continue
+		}
+		// every record is a gzip member of its own, so that
+		// readers can seek to the records
+		zw := gzip.NewWriter(&buf)
+		zw.Write(rb.Bytes())
+		zw.Close()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.f.Write(buf.Bytes())
+	return err
+}
+
+func (w *warcWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// recordWARC makes rt write the traffic to the file of -warc
+func recordWARC(rt http.RoundTripper) (http.RoundTripper, error) {
+	w, err := newWARCWriter(rt, *warcFile)
+	if err != nil {
+		return nil, err
+	}
+	atExit = append(atExit, func() {
+		if err := w.Close(); err != nil {
+			slog.Error("can't write -warc", "error", err)
+		}
+	})
+	return w, nil
+}
+
+// warcRequestHead returns the request line and the headers of req
+func warcRequestHead(req *http.Request) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&b, "Host: %s\r\n", host)
+	warcHeaders(&b, req.Header)
+	return b.Bytes()
+}
+
+// warcResponseHead returns the status line and the headers of resp. Go
+// removes the chunking of bodies, so there is no Transfer-Encoding.
+func warcResponseHead(resp *http.Response) []byte {
+	var b bytes.Buffer
+	status := strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)))
+	fmt.Fprintf(&b, "%s %d %s\r\n", resp.Proto, resp.StatusCode, status)
+	h := resp.Header.Clone()
+	h.Del("Transfer-Encoding")
+	warcHeaders(&b, h)
+	return b.Bytes()
+}
+
+func warcHeaders(b *bytes.Buffer, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(b, "%s: %s\r\n", k, v)
+		}
+	}
+	b.WriteString("\r\n")
+}
+
+// warcID returns a new record id, a random uuid
+func warcID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+func warcDigest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+func hasField(fields [][2]string, name string) bool {
+	for _, f := range fields {
+		if f[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isWARC reports whether b, the start of a file, is a WARC. Compressed
+// WARCs are a series of gzip members.
+func isWARC(b []byte) bool {
+	if bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return false
+		}
+		head := make([]byte, 5)
+		n, _ := io.ReadFull(zr, head)
+		b = head[:n]
+	}
+	return bytes.HasPrefix(b, []byte("WARC/"))
+}
+
+// loadWARC reads the response records of the WARC b for GET requests
+func loadWARC(b []byte) (*archive, error) {
+	var r io.Reader = bytes.NewReader(b)
+	if bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	}
+	br := bufio.NewReader(r)
+
+	// WARCs have request records only for some responses, so
+	// only those of other methods are skipped
+	methods := make(map[string]string)
+	a := newArchive()
+	redirected := make(map[string]bool)
+	for {
+		rec, err := readWARCRecord(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		typ := rec.field("WARC-Type")
+		target := strings.Trim(rec.field("WARC-Target-URI"), "<>")
+		switch {
+		case typ == "request":
+			if i := bytes.IndexByte(rec.block, ' '); i > 0 {
+				methods[rec.field("WARC-Concurrent-To")] = string(rec.block[:i])
+				methods[rec.field("WARC-Record-ID")] = string(rec.block[:i])
+			}
+			continue
+		case typ != "response" || !strings.HasPrefix(rec.field("Content-Type"), "application/http"):
+			continue
+		}
+		if m, ok := methods[rec.field("WARC-Record-ID")]; ok && m != "GET" {
+			continue
+		}
+		if m, ok := methods[rec.field("WARC-Concurrent-To")]; ok && m != "GET" {
+			continue
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.block)), nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", target, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil && len(body) == 0 {
+			return nil, fmt.Errorf("%s: %v", target, err)
+		}
+		if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+			encs := strings.Split(ce, ",")
+			var d io.Reader = bytes.NewReader(body)
+			for i := len(encs) - 1; i >= 0; i-- {
+				if d, _, err = decoder(encs[i], bufio.NewReader(d)); err != nil {
+					return nil, fmt.Errorf("%s: %v", target, err)
+				}
+			}
+			if body, err = io.ReadAll(d); err != nil {
+				return nil, fmt.Errorf("%s: %v", target, err)
+			}
+		}
+		a.add(target, &archivedResponse{resp.StatusCode, resp.Proto, resp.Header, body}, redirected)
+	}
+	return a, nil
+}
+
+// warcRead is a record read from a WARC
+type warcRead struct {
+	fields [][2]string
+	block  []byte
+}
+
+func (r *warcRead) field(name string) string {
+	for _, f := range r.fields {
+		if strings.EqualFold(f[0], name) {
+			return f[1]
+		}
+	}
+	return ""
+}
+
+// readWARCRecord reads the next record from br
+func readWARCRecord(br *bufio.Reader) (*warcRead, error) {
+	var line string
+	var err error
+	for line == "" {
+		if line, err = br.ReadString('\n'); err != nil {
+			if err == io.EOF && strings.TrimSpace(line) == "" {
+				return nil, io.EOF
+			}
+			return nil, io.ErrUnexpectedEOF
+		}
+		line = strings.TrimRight(line, "\r\n")
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("not a WARC record: %q", line)
+	}
+	rec := &warcRead{}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			rec.fields = append(rec.fields, [2]string{strings.TrimSpace(k), strings.TrimSpace(v)})
+		}
+	}
+	n, err := strconv.Atoi(rec.field("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("bad WARC Content-Length: %q", rec.field("Content-Length"))
+	}
+	rec.block = make([]byte, n)
+	if _, err := io.ReadFull(br, rec.block); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return rec, nil
+}
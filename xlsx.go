@@ -0,0 +1,300 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// xlsxFormat writes the results as an excel workbook, for people who
+// open them in a spreadsheet and keep fighting the encodings and
+// separators of csv. All urls are rows of one sheet, with a header of
+// the url key and the rule names, and lists are joined with newlines
+// in their cell. With -sheet-per-url each url has its own sheet with
+// a row for each match instead. Numbers and booleans are typed cells
+// and objects are json. The workbook is written on close.
+type xlsxFormat struct {
+	w      io.Writer
+	cols   []string
+	fixed  bool
+	sheets []xlsxSheet
+}
+
+// xlsxSheet is a sheet of the workbook and its rows of values
+type xlsxSheet struct {
+	name string
+	rows []map[string]interface{}
+}
+
+func newXLSXFormat(w io.Writer, rules []*rule) (formatter, error) {
+	f := &xlsxFormat{w: w, cols: []string{*key}, fixed: len(rules) > 0}
+	for _, r := range rules {
+		f.cols = append(f.cols, r.Name)
+	}
+	if !*sheetPerURL {
+		f.sheets = []xlsxSheet{{name: "results"}}
+	}
+	return f, nil
+}
+
+func (f *xlsxFormat) write(m map[string]interface{}) error {
+	if !f.fixed {
+		// without rules, from a pipeline, the columns
+		// are the keys of the results as they appear
+		var ks []string
+		for k := range m {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			if !contains(f.cols, k) {
+				f.cols = append(f.cols, k)
+			}
+		}
+	}
+
+	if !*sheetPerURL {
+		f.sheets[0].rows = append(f.sheets[0].rows, m)
+		return nil
+	}
+
+	s := xlsxSheet{name: f.sheetName(fmt.Sprint(m[*key]))}
+	for i := 0; i == 0 || i < xlsxRows(m); i++ {
+		row := make(map[string]interface{})
+		for k, v := range m {
+			if vs, ok := v.([]interface{}); ok {
+				if i < len(vs) {
+					row[k] = vs[i]
+				}
+			} else if i == 0 || k == *key {
+				row[k] = v
+			}
+		}
+		s.rows = append(s.rows, row)
+	}
+	f.sheets = append(f.sheets, s)
+	return nil
+}
+
+// xlsxRows returns the number of rows of m in its own sheet,
+// the length of its longest list
+func xlsxRows(m map[string]interface{}) int {
+	n := 0
+	for _, v := range m {
+		if vs, ok := v.([]interface{}); ok && len(vs) > n {
+			n = len(vs)
+		}
+	}
+	return n
+}
+
+// xlsxSheetNameRe matches the characters excel doesn't allow in sheet names
+var xlsxSheetNameRe = regexp.MustCompile(`[\[\]:*?/\\]+`)
+
+// sheetName returns a unique sheet name for the url u. Names
+// are at most 31 characters, so long urls are cut.
+func (f *xlsxFormat) sheetName(u string) string {
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	}
+	base := strings.Trim(xlsxSheetNameRe.ReplaceAllString(u, " "), " '")
+	if base == "" {
+		base = "url"
+	}
+	for n := 1; ; n++ {
+		name := base
+		if n > 1 {
+			name = fmt.Sprintf(" (%d)", n)
+			name = truncate(base, 31-len(name)) + name
+		}
+		name = truncate(name, 31)
+		unique := true
+		for _, s := range f.sheets {
+			if strings.EqualFold(s.name, name) {
+				unique = false
+			}
+		}
+		if unique {
+			return name
+		}
+	}
+}
+
+// truncate cuts s to at most n bytes without splitting characters
+func truncate(s string, n int) string {
+	for len(s) > n {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return s
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// close writes the workbook, a zip of the xml parts of the
+// sheets, the workbook, the styles and the relations between them
+func (f *xlsxFormat) close() error {
+	z := zip.NewWriter(f.w)
+	part := func(name, content string) error {
+		w, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, xml.Header+content)
+		return err
+	}
+
+	var types, sheets, rels strings.Builder
+	for i, s := range f.sheets {
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(s.name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		if err := part(fmt.Sprintf("xl/worksheets/sheet%d.xml", n), f.sheet(s)); err != nil {
+			return err
+		}
+	}
+
+	if err := part("[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`+
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`+
+		`<Default Extension="xml" ContentType="application/xml"/>`+
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`+
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`+
+		types.String()+`</Types>`); err != nil {
+		return err
+	}
+	if err := part("_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>`+
+		`</Relationships>`); err != nil {
+		return err
+	}
+	if err := part("xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`+
+		`<sheets>`+sheets.String()+`</sheets></workbook>`); err != nil {
+		return err
+	}
+	if err := part("xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+
+		rels.String()+`<Relationship Id="rIdStyles" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`+
+		`</Relationships>`); err != nil {
+		return err
+	}
+	if err := part("xl/styles.xml", xlsxStyles); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// sheet returns the xml of the sheet s, the header and the rows
+func (f *xlsxFormat) sheet(s xlsxSheet) string {
+	var b strings.Builder
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	b.WriteString(`<sheetData><row r="1">`)
+	for i, c := range f.cols {
+		xlsxCell(&b, i, 1, c, xlsxHeader)
+	}
+	b.WriteString(`</row>`)
+	for j, row := range s.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, j+2)
+		for i, c := range f.cols {
+			xlsxCell(&b, i, j+2, row[c], xlsxPlain)
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// the styles of the cells, indexes of cellXfs in xlsxStyles
+const (
+	xlsxPlain = iota
+	xlsxHeader
+	xlsxWrap
+)
+
+// xlsxStyles has a bold font for the header and wrapped
+// text for the lines of lists
+const xlsxStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0" applyAlignment="1"><alignment vertical="top" wrapText="1"/></xf></cellXfs>` +
+	`</styleSheet>`
+
+// xlsxMaxText is the maximum length of the text of a cell
+const xlsxMaxText = 32767
+
+// xlsxCell writes the cell of v at column i and row r with the style.
+// Lists have their values on separate lines and objects are json.
+func xlsxCell(b *strings.Builder, i, r int, v interface{}, style int) {
+	ref := xlsxColumn(i) + strconv.Itoa(r)
+	switch v := v.(type) {
+	case nil:
+	case float64:
+		fmt.Fprintf(b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'g', -1, 64))
+	case bool:
+		n := 0
+		if v {
+			n = 1
+		}
+		fmt.Fprintf(b, `<c r="%s" t="b"><v>%d</v></c>`, ref, n)
+	default:
+		text := xlsxText(v)
+		if n := utf8.RuneCountInString(text); n > xlsxMaxText {
+			text = string([]rune(text)[:xlsxMaxText])
+		}
+		if style == xlsxPlain && strings.Contains(text, "\n") {
+			style = xlsxWrap
+		}
+		fmt.Fprintf(b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(text))
+	}
+}
+
+// xlsxText returns the text of a string cell
+func xlsxText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var lines []string
+		for _, e := range v {
+			if e != nil {
+				lines = append(lines, xlsxText(e))
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// xlsxColumn returns the name of the column i, A to Z, AA and so on
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlFormat writes a yaml document per result. Unlike converting the
+// json, the members keep the order of the rules and the descriptions
+// of the rules, given with #"...", are comments above them.
+type yamlFormat struct {
+	enc   *yaml.Encoder
+	rules []*rule
+	// written is set once a document is written, the encoder
+	// can't be closed before
+	written bool
+}
+
+func newYAMLFormat(w io.Writer, rules []*rule) (formatter, error) {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	return &yamlFormat{enc: enc, rules: rules}, nil
+}
+
+func (f *yamlFormat) write(m map[string]interface{}) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range resultKeys(m, f.rules) {
+		kn := &yaml.Node{Kind: yaml.ScalarNode, Value: k}
+		for _, r := range f.rules {
+			if r.Name == k {
+				kn.HeadComment = r.Description
+			}
+		}
+		var vn yaml.Node
+		if err := vn.Encode(m[k]); err != nil {
+			return err
+		}
+		doc.Content = append(doc.Content, kn, &vn)
+	}
+	f.written = true
+	return f.enc.Encode(doc)
+}
+
+func (f *yamlFormat) close() error {
+	if !f.written {
+		return nil
+	}
+	return f.enc.Close()
+}